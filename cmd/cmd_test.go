@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/distek/tmux-tools/lib"
+	"github.com/distek/tmux-tools/lib/tmuxtest"
+)
+
+// fakeServer sends lib's commands to a new tmuxtest.Server for the rest of
+// the test
+func fakeServer(t *testing.T) *tmuxtest.Server {
+	t.Helper()
+
+	srv := tmuxtest.NewServer()
+	t.Cleanup(srv.Install())
+
+	return srv
+}
+
+// tmux runs a command on the fake server and fails the test if it errors
+func tmux(t *testing.T, name string, args ...string) string {
+	t.Helper()
+
+	o, e, err := lib.Command(name).Arg(args...).Run()
+	if err != nil {
+		t.Fatalf("%s %v: %s: %s", name, args, err, e)
+	}
+
+	return o
+}
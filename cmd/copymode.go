@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/distek/tmux-tools/lib"
@@ -15,25 +16,31 @@ var (
 	flagCopyNumbersTargetPane string
 )
 
-func getLineNumber(target string) (int, error) {
-	o, e, err := lib.Tmux(lib.GlobalArgs, "display-message", map[string]string{
-		"-t": target,
-		"-p": "",
-	}, "'#{copy_cursor_y}'")
+// copyCursor is target's height and its copy mode cursor line, which is -1
+// outside copy mode
+func copyCursor(target string) (int, int, error) {
+	o, e, err := lib.Command("display-message").Target(target).Flag("-p").Arg(copyNumbersFormat).Run()
 	if err != nil {
-		return -1, fmt.Errorf("%s: %s", err, e)
+		return 0, -1, fmt.Errorf("%s: %s", err, e)
 	}
 
-	if o == "" {
-		return -1, nil
+	h, y, _ := strings.Cut(o, " ")
+
+	height, err := strconv.Atoi(h)
+	if err != nil {
+		return 0, -1, err
+	}
+
+	if y == "" {
+		return height, -1, nil
 	}
 
-	i, err := strconv.Atoi(o)
+	line, err := strconv.Atoi(y)
 	if err != nil {
-		return -1, err
+		return 0, -1, err
 	}
 
-	return i, nil
+	return height, line, nil
 }
 
 func relative(l, currentLine int) string {
@@ -48,50 +55,101 @@ func relative(l, currentLine int) string {
 	return fmt.Sprintf("\033[0;97m%d\033[0m", l-currentLine)
 }
 
-var copyNumbersCmd = &cobra.Command{
-	Use:   "copy-numbers",
-	Short: "Show relative line numbers next to pane in copy mode",
-	Run: func(cmd *cobra.Command, args []string) {
-		initGlobalArgs()
+// drawCopyNumbers clears the screen and prints a number for each of the
+// height lines, relative to lineNumber
+func drawCopyNumbers(height, lineNumber int) {
+	fmt.Print("\033[H\033[2J")
 
-		if flagCopyNumbersShowLines {
-			lastLine := 0
-			for {
-				p, err := lib.GetCurrentPane(flagCopyNumbersTargetPane)
-				if err != nil {
-					return
-				}
+	for i := 0; i < height; i++ {
+		if i == height-1 {
+			fmt.Print(relative(i, lineNumber))
 
-				if p.CurrentMode != lib.PaneModeCopyMode {
-					return
-				}
+			break
+		}
 
-				lineNumber, err := getLineNumber(flagCopyNumbersTargetPane)
-				if lineNumber == -1 || err != nil {
-					return
-				}
+		fmt.Println(relative(i, lineNumber))
+	}
+}
 
-				if lineNumber == lastLine {
-					time.Sleep(time.Millisecond * 25)
-					continue
-				} else {
-					lastLine = lineNumber
-					fmt.Print("\033[H\033[2J")
-				}
+// The format copy-numbers polls: the pane's height and the copy mode cursor
+// line, which is empty outside copy mode
+const copyNumbersFormat = "#{pane_height} #{copy_cursor_y}"
+
+// How often copy-numbers asks where the cursor is. It asks over a control
+// mode connection, so this doesn't start a tmux process every time.
+const copyNumbersInterval = time.Millisecond * 25
+
+// showCopyNumbers draws relative line numbers for target until it leaves
+// copy mode, redrawing when the cursor moves or the pane is resized. Leaving
+// copy mode comes in as a %pane-mode-changed; the cursor is polled.
+func showCopyNumbers(target string) {
+	client, err := lib.Connect(target)
+	if err != nil {
+		return
+	}
 
-				for i := 0; i < p.Height; i++ {
-					if i == p.Height-1 {
-						fmt.Print(relative(i, lineNumber))
+	lib.SetRunner(client)
+	defer func() {
+		lib.SetRunner(nil)
+		_ = client.Close()
+	}()
 
-						break
-					}
+	events, cancel := client.Subscribe()
+	defer cancel()
 
-					fmt.Println(relative(i, lineNumber))
+	ticker := time.NewTicker(copyNumbersInterval)
+	defer ticker.Stop()
+
+	height, lineNumber := 0, -1
+
+	for {
+		h, y, err := copyCursor(target)
+		if err != nil || y == -1 {
+			return
+		}
+
+		if h != height || y != lineNumber {
+			height, lineNumber = h, y
+			drawCopyNumbers(height, lineNumber)
+		}
+
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+
+			switch ev := ev.(type) {
+			case lib.PaneModeChangedEvent:
+				if ev.PaneID != target {
+					continue
 				}
 
-				time.Sleep(time.Millisecond * 25)
+				p, err := lib.GetCurrentPane(target)
+				if err != nil || p.CurrentMode != lib.PaneModeCopyMode {
+					return
+				}
+			case lib.ExitEvent:
+				return
 			}
+		case <-ticker.C:
 		}
+	}
+}
+
+var copyNumbersCmd = &cobra.Command{
+	Use:   "copy-numbers",
+	Short: "Show relative line numbers next to pane in copy mode",
+	Run: func(cmd *cobra.Command, args []string) {
+		initGlobalArgs()
+
+		if flagCopyNumbersShowLines {
+			showCopyNumbers(flagCopyNumbersTargetPane)
+			return
+		}
+
+		requireTmux(lib.FeatureCopyCursor)
+		requireTmux(lib.FeatureSubscriptions)
 
 		p, err := lib.GetCurrentPane("")
 		if err != nil {
@@ -102,16 +160,16 @@ var copyNumbersCmd = &cobra.Command{
 			return
 		}
 
-		_, _, err = lib.Tmux(lib.GlobalArgs, "split-window", map[string]string{
-			"-h": "",
-			"-b": "",
-			"-l": "2",
-		}, fmt.Sprintf("%s copy-numbers -l -t %s", os.Args[0], p.ID))
+		_, _, err = lib.Command("split-window").
+			Flag("-h", "-b").
+			Opt("-l", "2").
+			Arg(os.Args[0], "copy-numbers", "-l", "-t", p.ID).
+			Run()
 		if err != nil {
 			os.Exit(1)
 		}
 
-		_, _, err = lib.Tmux(lib.GlobalArgs, "last-pane", map[string]string{}, "")
+		_, _, err = lib.Command("last-pane").Run()
 
 		if err != nil {
 			return
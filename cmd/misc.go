@@ -3,7 +3,6 @@ package cmd
 import (
 	"log"
 	"os"
-	"strings"
 
 	"github.com/distek/tmux-tools/lib"
 	"github.com/spf13/cobra"
@@ -15,21 +14,21 @@ var cleanCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		initGlobalArgs()
 
-		o, e, err := lib.Tmux(lib.GlobalArgs, "ls", nil, "")
+		sessions, err := lib.ListSessions()
 		if err != nil {
-			log.Println(e)
 			log.Fatal(err)
 		}
 
-		for _, v := range strings.Split(o, "\n") {
-			if v == "" {
-				continue
-			}
-
-			if !strings.Contains(v, "(attached)") {
-				id := strings.Split(v, ":")[0]
+		// Control mode clients (autosave's, for one) don't keep a
+		// session around
+		attached, err := lib.AttachedSessions()
+		if err != nil {
+			log.Fatal(err)
+		}
 
-				_, e, err := lib.Tmux(lib.GlobalArgs, "kill-window", map[string]string{"-t": id}, "")
+		for _, s := range sessions {
+			if !attached[s.Name] {
+				_, e, err := lib.Command("kill-window").Target(lib.ActiveTarget(s.Name)).Run()
 				if err != nil {
 					log.Println(e)
 					log.Fatal(err)
@@ -37,7 +36,6 @@ var cleanCmd = &cobra.Command{
 				}
 			}
 		}
-
 	},
 }
 
@@ -59,21 +57,24 @@ var focusPaneCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		disconnect := useControlClient()
+		defer disconnect()
+
 		p, err := lib.GetCurrentPane("")
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		neighbors, err := lib.GetNeighbors(p)
+		neighbor, ok, err := lib.GetPaneInDir(p, dir)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		if !neighbors.Panes[dir].Exists {
+		if !ok {
 			log.Fatalf("no pane in dir %s", dir)
 		}
 
-		err = lib.FocusPane(neighbors.Panes[dir].Pane)
+		err = lib.FocusPane(neighbor)
 		if err != nil {
 			log.Fatal(err)
 		}
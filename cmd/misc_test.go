@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	srv := fakeServer(t)
+
+	tmux(t, "new-session", "-d", "-s", "used")
+	tmux(t, "attach-session", "-t", "=used")
+	tmux(t, "new-session", "-d", "-s", "idle")
+	tmux(t, "new-session", "-d", "-s", "watched")
+
+	// Only a control mode client, like autosave's, on this one
+	srv.Session("watched").Control = 1
+
+	cleanCmd.Run(cleanCmd, nil)
+
+	var names []string
+	for _, s := range srv.Sessions() {
+		names = append(names, s.Name)
+	}
+
+	if !slices.Equal(names, []string{"used"}) {
+		t.Errorf("sessions left: %v, want [used]", names)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/distek/tmux-tools/lib"
@@ -85,20 +86,89 @@ func spawnWatcher(pid int) {
 	}
 }
 
-func watcher(pid int) {
-	// Give time for the nested socket to start
-	time.Sleep(time.Second * 1)
+// How long the watcher waits for the nested server to come up
+const nestStartTimeout = time.Second * 5
+
+// How often the watcher checks whether the tmux client it started is still
+// running, on servers too old to say when clients detach
+const nestPIDInterval = time.Second
+
+// nestConnect connects to the nested server once it's up, giving up when
+// the tmux client that starts it (pid) is gone
+func nestConnect(pid int) (*lib.Client, error) {
+	deadline := time.Now().Add(nestStartTimeout)
 
 	for {
-		_, err := os.FindProcess(pid)
-		if err != nil || !lib.SockHasAttached(flagTmuxSockPath) {
-			lib.KillServer(flagTmuxSockPath)
-			time.Sleep(time.Second * 5)
-			lib.KillServer(flagTmuxSockPath)
-			return
+		client, err := lib.Connect("")
+		if err == nil {
+			return client, nil
+		}
+
+		if time.Now().After(deadline) || syscall.Kill(pid, 0) != nil {
+			return nil, err
+		}
+
+		time.Sleep(time.Millisecond * 100)
+	}
+}
+
+func watcher(pid int) {
+	client, err := nestConnect(pid)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	events, cancel := client.Subscribe()
+	defer cancel()
+
+	// Only clients detaching (or the server going away) can leave the socket
+	// unattached, so there's nothing to check in between
+	check := func() bool {
+		if lib.SockHasAttached(flagTmuxSockPath) {
+			return false
 		}
 
-		time.Sleep(time.Second * 5)
+		_ = client.Close()
+		lib.KillServer(flagTmuxSockPath)
+
+		return true
+	}
+
+	if check() {
+		return
+	}
+
+	// Before tmux 3.2 there's no %client-detached, so the client nest
+	// started going away is what's watched for instead
+	var tick <-chan time.Time
+	if !lib.Supports(lib.FeatureDetachEvents) {
+		ticker := time.NewTicker(nestPIDInterval)
+		defer ticker.Stop()
+
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+
+			switch ev.(type) {
+			case lib.ClientDetachedEvent:
+				if check() {
+					return
+				}
+			case lib.ExitEvent:
+				return
+			}
+		case <-tick:
+			if syscall.Kill(pid, 0) != nil && check() {
+				return
+			}
+		}
 	}
 }
 
@@ -18,6 +18,43 @@ var (
 	flagNotesH string
 )
 
+// notesAttach is the shell command that attaches to the notes server at
+// sockPath
+func notesAttach(sockPath string) string {
+	return fmt.Sprintf("tmux -S %s a -t 0", lib.ShellQuote(sockPath))
+}
+
+// notesPopup opens a popup on the current server attached to the notes server
+// at sockPath. Servers without display-popup get a split on the right instead.
+func notesPopup(sockPath string) *lib.Cmd {
+	if !lib.Supports(lib.FeaturePopup) {
+		return notesSplit(sockPath)
+	}
+
+	return lib.Command("popup").
+		Flag("-E").
+		Opt("-x", flagNotesX).
+		Opt("-y", flagNotesY).
+		Opt("-w", flagNotesW).
+		Opt("-h", flagNotesH).
+		Arg(notesAttach(sockPath))
+}
+
+// notesSplit is notesPopup for servers older than 3.2, sized by the width
+// flag
+func notesSplit(sockPath string) *lib.Cmd {
+	c := lib.Command("split-window").Flag("-h")
+
+	// -l only takes percentages from 3.1 on, -p works everywhere
+	if pct, ok := strings.CutSuffix(flagNotesW, "%"); ok {
+		c.Opt("-p", pct)
+	} else {
+		c.Opt("-l", flagNotesW)
+	}
+
+	return c.Arg(notesAttach(sockPath))
+}
+
 var notesCmd = &cobra.Command{
 	Use:   "notes",
 	Short: "spawn a notes window for the current directory",
@@ -25,8 +62,6 @@ var notesCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		initGlobalArgs()
 
-		globalSock, globalSockSpecified := lib.GlobalArgs["-S"]
-
 		p, err := lib.GetCurrentPane("")
 		if err != nil {
 			log.Fatal(err)
@@ -59,12 +94,8 @@ var notesCmd = &cobra.Command{
 
 		if !lib.SockExists(sockPath) {
 			if lib.SockActive(sockPath) {
-				if globalSockSpecified {
-					lib.GlobalArgs["-S"] = globalSock
-				}
-
 				if lib.SockHasAttached(sockPath) {
-					o, e, err := lib.Tmux(map[string]string{"-S": sockPath}, "detach", nil, "")
+					o, e, err := lib.Command("detach").Socket(sockPath).Run()
 					if err != nil {
 						fmt.Println(o)
 						fmt.Println(e)
@@ -74,13 +105,7 @@ var notesCmd = &cobra.Command{
 					return
 				}
 
-				o, e, err := lib.Tmux(lib.GlobalArgs, "popup", map[string]string{
-					"-E": "",
-					"-x": flagNotesX,
-					"-y": flagNotesY,
-					"-w": flagNotesW,
-					"-h": flagNotesH,
-				}, fmt.Sprintf("tmux -S %s a -t 0", sockPath))
+				o, e, err := notesPopup(sockPath).Run()
 				if err != nil {
 					fmt.Println(o)
 					fmt.Println(e)
@@ -91,42 +116,30 @@ var notesCmd = &cobra.Command{
 			}
 		}
 
-		o, e, err := lib.Tmux(map[string]string{"-S": sockPath, "-f": "/dev/null"}, "new", map[string]string{"-d": ""},
-			fmt.Sprintf("nvim %s", notesFile),
-		)
+		o, e, err := lib.Command("new").Socket(sockPath).ConfigFile("/dev/null").Flag("-d").Arg("nvim", notesFile).Run()
 		if err != nil {
 			fmt.Println(o)
 			fmt.Println(e)
 			log.Fatal(err)
 		}
-		_, _, err = lib.Tmux(map[string]string{"-S": sockPath}, "set", map[string]string{"-g": "status-keys vi"}, "")
+		_, _, err = lib.Command("set").Socket(sockPath).Flag("-g").Arg("status-keys", "vi").Run()
 		if err != nil {
 			log.Fatal(err)
 		}
-		_, _, err = lib.Tmux(map[string]string{"-S": sockPath}, "set", map[string]string{"-g": "mode-keys vi"}, "")
+		_, _, err = lib.Command("set").Socket(sockPath).Flag("-g").Arg("mode-keys", "vi").Run()
 		if err != nil {
 			log.Fatal(err)
 		}
-		_, _, err = lib.Tmux(map[string]string{"-S": sockPath}, "set", map[string]string{"-g": "status off"}, "")
+		_, _, err = lib.Command("set").Socket(sockPath).Flag("-g").Arg("status", "off").Run()
 		if err != nil {
 			log.Fatal(err)
 		}
-		_, _, err = lib.Tmux(map[string]string{"-S": sockPath}, "bind", map[string]string{"-n": "'M-n' detach"}, "")
+		_, _, err = lib.Command("bind").Socket(sockPath).Flag("-n").Arg("M-n", "detach").Run()
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		if globalSockSpecified {
-			lib.GlobalArgs["-S"] = globalSock
-		}
-
-		o, e, err = lib.Tmux(lib.GlobalArgs, "popup", map[string]string{
-			"-E": "",
-			"-x": flagNotesX,
-			"-y": flagNotesY,
-			"-w": flagNotesW,
-			"-h": flagNotesH,
-		}, fmt.Sprintf("tmux -S %s a -t 0", sockPath))
+		o, e, err = notesPopup(sockPath).Run()
 		if err != nil {
 			fmt.Println(o)
 			fmt.Println(e)
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/distek/tmux-tools/lib"
+	"github.com/spf13/cobra"
+)
+
+var flagPickPrompt string
+
+var pickCmd = &cobra.Command{
+	Use:   "pick",
+	Short: "pick one of the lines on stdin with the built-in fuzzy finder",
+	Long: `Reads a list from stdin and prints the line picked, like a small fzf. It
+draws on the terminal even with stdin and stdout redirected. Nothing picked
+exits with status 1.
+
+This is also what the other commands open in a tmux popup when they need a
+choice, fzf isn't installed and there's no terminal to ask on.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		initGlobalArgs()
+
+		var items []string
+
+		sc := bufio.NewScanner(os.Stdin)
+		for sc.Scan() {
+			if sc.Text() != "" {
+				items = append(items, sc.Text())
+			}
+		}
+
+		if err := sc.Err(); err != nil {
+			log.Fatal(err)
+		}
+
+		picked, err := lib.Pick(items, flagPickPrompt)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if picked == "" {
+			os.Exit(1)
+		}
+
+		fmt.Println(picked)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pickCmd)
+
+	pickCmd.Flags().StringVar(&flagPickPrompt, "prompt", "> ", "prompt shown before the query")
+
+	if exe, err := os.Executable(); err == nil {
+		lib.PickCommand = []string{exe, "pick"}
+	}
+}
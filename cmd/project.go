@@ -0,0 +1,297 @@
+package cmd
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/distek/tmux-tools/lib"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	defaultProjectMarkers = []string{".git", "go.mod", "package.json"}
+	defaultProjectDepth   = 2
+)
+
+var flagProjectDepth int
+
+// projectRoots is the roots given as args, then project.roots from the
+// config, then the home directory
+func projectRoots(args []string) []string {
+	roots := args
+	if len(roots) == 0 {
+		roots = viper.GetStringSlice("project.roots")
+	}
+
+	if len(roots) == 0 {
+		if home, err := os.UserHomeDir(); err == nil {
+			roots = []string{home}
+		}
+	}
+
+	ret := make([]string, 0, len(roots))
+	for _, r := range roots {
+		ret = append(ret, expandPath(r, ""))
+	}
+
+	return ret
+}
+
+// projectDepth is --depth, then project.depth, then the default
+func projectDepth(cmd *cobra.Command) int {
+	if cmd.Flags().Changed("depth") {
+		return flagProjectDepth
+	}
+
+	if viper.IsSet("project.depth") {
+		return viper.GetInt("project.depth")
+	}
+
+	return defaultProjectDepth
+}
+
+// projectMarkers is project.markers, or the defaults
+func projectMarkers() []string {
+	if viper.IsSet("project.markers") {
+		return viper.GetStringSlice("project.markers")
+	}
+
+	return defaultProjectMarkers
+}
+
+// isProject reports whether dir has any of markers in it
+func isProject(dir string, markers []string) bool {
+	for _, m := range markers {
+		if _, err := os.Stat(filepath.Join(dir, m)); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findProjects returns the directories under roots, at most depth levels
+// down, with a project marker in them. It doesn't look inside projects, or
+// in hidden directories and node_modules.
+func findProjects(roots []string, depth int, markers []string) []string {
+	var ret []string
+
+	for _, root := range roots {
+		root = filepath.Clean(root)
+
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// Unreadable directories are just skipped
+				if path != root && d != nil && d.IsDir() {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+
+			if !d.IsDir() {
+				return nil
+			}
+
+			if path != root && (strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules") {
+				return filepath.SkipDir
+			}
+
+			if isProject(path, markers) {
+				ret = append(ret, path)
+
+				// A root that's a project itself still gets searched,
+				// for monorepos and the like
+				if path != root {
+					return filepath.SkipDir
+				}
+			}
+
+			rel, _ := filepath.Rel(root, path)
+			if rel != "." && strings.Count(rel, string(filepath.Separator))+1 >= depth {
+				return filepath.SkipDir
+			}
+
+			return nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Println(err)
+		}
+	}
+
+	slices.Sort(ret)
+
+	return slices.Compact(ret)
+}
+
+// projectSessionName is the session name for the project at dir, the way
+// tmux will store it. That's the directory's name, or with qualify, its
+// parent's name and its own, so ~/work/api and ~/personal/api become
+// work/api and personal/api instead of both being api.
+func projectSessionName(dir string, qualify bool) string {
+	name := filepath.Base(dir)
+	if qualify {
+		name = filepath.Base(filepath.Dir(dir)) + "/" + name
+	}
+
+	return lib.SessionName(name)
+}
+
+// sharesName reports whether another project in projects has the same
+// directory name as dir
+func sharesName(dir string, projects []string) bool {
+	for _, p := range projects {
+		if p != dir && filepath.Base(p) == filepath.Base(dir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tildePath shows paths under the home directory with a ~
+func tildePath(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	if rest, ok := strings.CutPrefix(path, home+string(filepath.Separator)); ok {
+		return "~" + string(filepath.Separator) + rest
+	}
+
+	return path
+}
+
+// projectSession is what to start for the project at dir: a saved session
+// that starts in dir or has its name, a template with its name or the
+// project.template from the config, in that order. ok is false if there's
+// none of those.
+func projectSession(dir, name string) (Session, bool, error) {
+	sessions := getSessions(flagSessionsDir)
+
+	for _, s := range sessions {
+		if sessionRoot(s) == dir {
+			return s, true, nil
+		}
+	}
+
+	if s, ok := findSession(sessions, name); ok {
+		return s, true, nil
+	}
+
+	tmpl := name
+
+	path, err := templatePath(tmpl)
+	if err != nil {
+		tmpl = viper.GetString("project.template")
+		if tmpl == "" {
+			return Session{}, false, nil
+		}
+
+		path, err = templatePath(tmpl)
+		if err != nil {
+			return Session{}, false, err
+		}
+	}
+
+	s, err := renderTemplate(path, map[string]string{"Root": dir, "Name": name})
+	if err != nil {
+		return Session{}, false, err
+	}
+
+	return s, true, nil
+}
+
+var projectCmd = &cobra.Command{
+	Use:   "project [root...]",
+	Short: "pick a project with fzf and switch to its session, starting it if needed",
+	Long: `Looks for directories with a project marker (.git, go.mod, package.json by
+default) under the roots given, or project.roots from the config.
+
+A new session is started from the saved session that starts in the
+project's directory or is named after it, then from the template named after
+it or project.template, and otherwise is a plain session in the directory.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		initGlobalArgs()
+
+		projects := findProjects(projectRoots(args), projectDepth(cmd), projectMarkers())
+		if len(projects) == 0 {
+			log.Fatal("no projects found")
+		}
+
+		shown := make([]string, 0, len(projects))
+		for _, p := range projects {
+			shown = append(shown, tildePath(p))
+		}
+
+		picked, err := lib.Fzf(shown)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if picked == "" {
+			return
+		}
+
+		i := slices.Index(shown, picked)
+		if i < 0 {
+			log.Fatalf("%s isn't one of the projects", picked)
+		}
+
+		dir := projects[i]
+		name := projectSessionName(dir, sharesName(dir, projects))
+
+		// A session by that name that was started somewhere else isn't
+		// this project's
+		if s, err := lib.GetSession(lib.ActiveTarget(name)); err == nil && s.Path != dir {
+			name = projectSessionName(dir, true)
+		}
+
+		if lib.HasSession(name) {
+			attachSession(name)
+			return
+		}
+
+		session, ok, err := projectSession(dir, name)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if !ok {
+			_, e, err := lib.Command("new-session").Flag("-d").Opt("-s", name).StartDir(dir).Run()
+			if err != nil {
+				log.Println(e)
+				log.Fatal(err)
+			}
+
+			attachSession(name)
+			return
+		}
+
+		if lib.HasSession(session.Name) {
+			attachSession(session.Name)
+			return
+		}
+
+		err = restoreSession(session)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		attachSession(session.Name)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(projectCmd)
+
+	projectCmd.Flags().IntVar(&flagProjectDepth, "depth", defaultProjectDepth, "how many directories down to look for projects (config: project.depth)")
+	projectCmd.Flags().StringVarP(&flagSessionsDir, "dir", "d", defaultSessionsDir, "directory with saved sessions")
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFindProjects(t *testing.T) {
+	root := t.TempDir()
+
+	for _, f := range []string{
+		// The root is a project itself, and still gets searched
+		"go.mod",
+		"work/api/go.mod",
+		"work/api/vendor/lib/go.mod",
+		"personal/api/.git/HEAD",
+		"personal/site/package.json",
+		".cache/thing/go.mod",
+		"node_modules/x/package.json",
+		"too/deep/here/go.mod",
+	} {
+		path := filepath.Join(root, f)
+
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.WriteFile(path, nil, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := findProjects([]string{root}, 2, defaultProjectMarkers)
+
+	want := []string{
+		root,
+		filepath.Join(root, "personal/api"),
+		filepath.Join(root, "personal/site"),
+		filepath.Join(root, "work/api"),
+	}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestProjectSessionName(t *testing.T) {
+	projects := []string{"/home/me/work/api", "/home/me/personal/api", "/home/me/work/tmux.nvim"}
+
+	tests := []struct {
+		dir  string
+		want string
+	}{
+		{"/home/me/work/api", "work/api"},
+		{"/home/me/personal/api", "personal/api"},
+		{"/home/me/work/tmux.nvim", "tmux_nvim"},
+	}
+
+	for _, tt := range tests {
+		if got := projectSessionName(tt.dir, sharesName(tt.dir, projects)); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.dir, got, tt.want)
+		}
+	}
+}
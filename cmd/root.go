@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"log"
 	"os"
 
 	"github.com/distek/tmux-tools/lib"
@@ -66,6 +67,32 @@ func initGlobalArgs() {
 	}
 }
 
+// requireTmux exits with a message naming the tmux version f needs if the
+// server or client is older than that
+func requireTmux(f lib.Feature) {
+	err := lib.Require(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// useControlClient sends lib's tmux commands over one control mode connection
+// instead of starting a tmux process for each. The returned func disconnects.
+// If connecting fails, commands keep going through their own processes.
+func useControlClient() func() {
+	c, err := lib.Connect(os.Getenv("TMUX_PANE"))
+	if err != nil {
+		return func() {}
+	}
+
+	lib.SetRunner(c)
+
+	return func() {
+		lib.SetRunner(nil)
+		_ = c.Close()
+	}
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
 
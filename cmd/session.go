@@ -2,17 +2,20 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/adrg/xdg"
 	"github.com/distek/tmux-tools/lib"
+	"github.com/distek/tmux-tools/lib/layout"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 type SessPane struct {
@@ -20,6 +23,26 @@ type SessPane struct {
 	Index   int    `json:"index"`
 	Path    string `json:"path"`
 	Command string `json:"command"`
+
+	// Before are commands run in the pane before Command, like tmuxinator's
+	// pre_window
+	Before []string `json:"before,omitempty"`
+
+	// Title is the pane's title, if anything set one
+	Title string `json:"title,omitempty"`
+
+	// Options are the sessions.pane_options set on the pane
+	Options map[string]string `json:"options,omitempty"`
+
+	// Argv is the command's exact arguments where they could be read from
+	// /proc. Command is then the same thing as a shell command line.
+	Argv []string `json:"argv,omitempty"`
+
+	// Scrollback is the file with the pane's saved history, relative to the
+	// session JSON
+	Scrollback string `json:"scrollback,omitempty"`
+
+	id string
 }
 
 type SessWin struct {
@@ -28,24 +51,36 @@ type SessWin struct {
 	Layout  string     `json:"layout"`
 	Name    string     `json:"name"`
 	Panes   []SessPane `json:"panes"`
+
+	Zoomed bool `json:"zoomed,omitempty"`
+
+	// Options are the sessions.window_options set on the window
+	Options map[string]string `json:"options,omitempty"`
 }
 
 type Session struct {
+	Version int       `json:"version"`
 	Name    string    `json:"name"`
+	Saved   time.Time `json:"saved"`
 	Windows []SessWin `json:"windows"`
-}
 
-const (
-	sessionWinLinesFmt     = "\"#{window_index}%#{window_name}%#{window_layout}%#{window_active}\""
-	sessionEmtpyWinLineFmt = "%%%"
+	// Environment is what set-environment set in the session
+	Environment map[string]string `json:"environment,omitempty"`
 
-	sessionPaneLinesFmt     = "\"#{pane_index}%#{pane_pid}%#{pane_current_path}%#{pane_active}\""
-	sessionEmtpyPaneLineFmt = "%%%"
-)
+	// Options are the sessions.session_options set on the session
+	Options map[string]string `json:"options,omitempty"`
+
+	// File is where the session was read from
+	File string `json:"-"`
+}
+
+var defaultSessionsDir = xdg.ConfigHome + "/tmux-tools/sessions"
 
 var (
-	flagSessionName string
-	flagSessionsDir string
+	flagSessionName   string
+	flagSessionsDir   string
+	flagSessionAttach bool
+	flagSessionsAll   bool
 )
 
 var sessionCmd = &cobra.Command{
@@ -56,141 +91,173 @@ var sessionCmd = &cobra.Command{
 	},
 }
 
-var sessionSaveCmd = &cobra.Command{
-	Use:   "save",
-	Short: "save a session",
-	Run: func(cmd *cobra.Command, args []string) {
-		if flagSessionName == "" {
-			fmt.Print("Session name: ")
-			_, err := fmt.Scanln(&flagSessionName)
-			if err != nil {
-				log.Fatal(err)
-			}
-		}
+// captureSession records the windows and panes of the session at target (the
+// current one if empty) as name
+func captureSession(target, name string) (Session, error) {
+	windows, err := lib.ListWindows(target)
+	if err != nil {
+		return Session{}, fmt.Errorf("cmd: captureSession: %s", err)
+	}
 
-		if _, err := os.Stat(flagSessionsDir); err != nil {
-			err := os.MkdirAll(flagSessionsDir, 0750)
-			if err != nil {
-				log.Fatal(err)
-			}
-		}
+	rules, err := restoreRules()
+	if err != nil {
+		return Session{}, err
+	}
 
-		if flagSessionName == "" {
-			// TODO: Be kinda cool to do a randomized name?
-			log.Fatal("Give it a name.")
-		}
+	var session Session
 
-		winLines, e, err := lib.Tmux(lib.GlobalArgs, "list-windows", map[string]string{
-			"-F": sessionWinLinesFmt,
-		}, "")
+	session.Version = schemaVersion
+	session.Name = name
+	session.Saved = time.Now()
+
+	session.Environment, err = lib.GetEnvironment(target)
+	if err != nil {
+		return Session{}, fmt.Errorf("cmd: captureSession: %s", err)
+	}
+
+	session.Options, err = lib.GetOptions(target, lib.OptionSession, sessionOptions())
+	if err != nil {
+		return Session{}, fmt.Errorf("cmd: captureSession: %s", err)
+	}
+
+	for _, w := range windows {
+		var thisWin SessWin
+
+		thisWin.Index = w.Index
+		thisWin.Layout = w.Layout
+		thisWin.Current = w.Active
+		thisWin.Zoomed = w.Zoomed
+
+		thisWin.Options, err = lib.GetOptions(w.ID, lib.OptionWindow, windowOptions())
 		if err != nil {
-			log.Println(e)
-			log.Fatal(err)
+			return Session{}, fmt.Errorf("cmd: captureSession: %s", err)
 		}
 
-		var session Session
-
-		session.Name = flagSessionName
+		panes, err := lib.ListPanes(w.ID)
+		if err != nil {
+			return Session{}, fmt.Errorf("cmd: captureSession: %s", err)
+		}
 
-		for w := range strings.SplitSeq(winLines, "\n") {
-			if w == "" || w == sessionEmtpyWinLineFmt {
-				continue
-			}
-			var thisWin SessWin
+		focused := false
+		for _, p := range panes {
+			var thisPane SessPane
 
-			winSplit := strings.Split(w, "%")
+			thisPane.Index = p.Index
+			thisPane.id = p.ID
+			thisPane.Title = paneTitle(p)
 
-			thisWin.Index, err = strconv.Atoi(winSplit[0])
+			thisPane.Options, err = lib.GetOptions(p.ID, lib.OptionPane, paneOptions())
 			if err != nil {
-				log.Fatal(err)
+				return Session{}, fmt.Errorf("cmd: captureSession: %s", err)
 			}
 
-			thisWin.Layout = winSplit[2]
+			thisPane.Argv, err = lib.GetProcArgv(p.PID)
+			switch {
+			case errors.Is(err, lib.ErrProcUnsupported):
+				thisPane.Command, err = lib.GetProcCmd(p.PID)
+				if err != nil {
+					thisPane.Command = ""
+				}
+			case err != nil:
+				thisPane.Argv = nil
+			default:
+				thisPane.Command = lib.ShellJoin(thisPane.Argv)
+			}
 
-			thisWin.Current = lib.TmuxBool(winSplit[3])
+			thisPane.Path = p.Cwd
 
-			paneLines, e, err := lib.Tmux(lib.GlobalArgs, "list-panes", map[string]string{
-				"-t": fmt.Sprint(thisWin.Index),
-				"-F": sessionPaneLinesFmt,
-			}, "")
-			if err != nil {
-				log.Println(e)
-				log.Fatal(err)
+			// Only keep commands the restore config says to
+			if !rules.keep(thisPane) {
+				thisPane.Command = ""
+				thisPane.Argv = nil
 			}
 
-			focused := false
-			for p := range strings.SplitSeq(paneLines, "\n") {
-				if p == "" || p == sessionEmtpyPaneLineFmt {
-					continue
+			thisPane.Current = p.Active
+			if thisPane.Current {
+				// If the name of the window is the same as the currently focused command
+				// we'll leave it blank and let tmux pick the name. Otherwise, the user has
+				// likely chosen this window's name on purpose
+				if strings.HasPrefix(thisPane.Command, w.Name) ||
+					(len(thisPane.Argv) > 0 && strings.HasPrefix(filepath.Base(thisPane.Argv[0]), w.Name)) {
+					focused = true
 				}
+			}
 
-				var thisPane SessPane
+			thisWin.Panes = append(thisWin.Panes, thisPane)
+		}
 
-				paneSplit := strings.Split(p, "%")
+		// Turning automatic-rename off is how tmux remembers a window was
+		// named by hand
+		if !focused || thisWin.Options["automatic-rename"] == "off" {
+			thisWin.Name = w.Name
+		}
 
-				thisPane.Index, err = strconv.Atoi(paneSplit[0])
-				if err != nil {
-					log.Fatal(err)
-				}
+		session.Windows = append(session.Windows, thisWin)
+	}
 
-				pid, err := strconv.Atoi(paneSplit[1])
-				if err != nil {
-					log.Fatal(err)
-				}
+	return session, nil
+}
 
-				thisPane.Command, err = lib.GetProcCmd(pid)
-				if err != nil {
-					thisPane.Command = ""
-				}
+// writeJSON writes v to path, making the directories on the way
+func writeJSON(path string, v any) error {
+	err := os.MkdirAll(filepath.Dir(path), 0750)
+	if err != nil {
+		return err
+	}
 
-				// if the current command is not within the allowed list, clear it
-				if sessionsConfig := viper.GetStringMapStringSlice("sessions"); sessionsConfig != nil {
-					if restoreCmds, ok := sessionsConfig["restore_cmds"]; ok {
-						allowed := false
-						for _, c := range restoreCmds {
-							if strings.HasPrefix(thisPane.Command, c) {
-								allowed = true
-								break
-							}
-						}
-
-						if !allowed {
-							thisPane.Command = ""
-						}
-					}
-				}
+	s, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
 
-				thisPane.Path = paneSplit[2]
+	return os.WriteFile(path, s, 0640)
+}
 
-				thisPane.Current = lib.TmuxBool(paneSplit[3])
-				if thisPane.Current {
-					// If the name of the window is the same as the currently focused command
-					// we'll leave it blank and let tmux pick the name. Otherwise, the user has
-					// likely chosen this window's name on purpose
-					if strings.HasPrefix(thisPane.Command, winSplit[1]) {
-						focused = true
-					}
-				}
+var sessionSaveCmd = &cobra.Command{
+	Use:   "save",
+	Short: "save a session",
+	Run: func(cmd *cobra.Command, args []string) {
+		initGlobalArgs()
 
-				thisWin.Panes = append(thisWin.Panes, thisPane)
-			}
+		if flagSessionsAll {
+			saveAll(cmd)
+			return
+		}
 
-			if !focused {
-				thisWin.Name = winSplit[1]
+		if flagSessionName == "" {
+			fmt.Print("Session name: ")
+			_, err := fmt.Scanln(&flagSessionName)
+			if err != nil {
+				log.Fatal(err)
 			}
+		}
+
+		if flagSessionName == "" {
+			// TODO: Be kinda cool to do a randomized name?
+			log.Fatal("Give it a name.")
+		}
 
-			session.Windows = append(session.Windows, thisWin)
+		session, err := captureSession("", flagSessionName)
+		if err != nil {
+			log.Fatal(err)
 		}
 
-		s, err := json.Marshal(session)
+		path := filepath.Join(flagSessionsDir, flagSessionName+".json")
+
+		// Don't leave the last save's scrollback lying around
+		err = os.RemoveAll(filepath.Join(flagSessionsDir, scrollbackDir(path, -1)))
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		err = os.WriteFile(
-			flagSessionsDir+"/"+flagSessionName+".json",
-			s,
-			0640)
+		if scrollbackEnabled(cmd) {
+			err = saveScrollback(&session, flagSessionsDir, scrollbackDir(path, -1), scrollbackLines(cmd))
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		err = writeJSON(path, session)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -202,10 +269,21 @@ func getSessions(dir string) []Session {
 
 	errExt := filepath.WalkDir(dir, func(path string, info os.DirEntry, err error) error {
 		if err != nil {
-			return err
+			if path == dir {
+				return err
+			}
+
+			log.Println(err)
+
+			return nil
 		}
 
 		if info.IsDir() {
+			// Whole-server snapshots aren't sessions
+			if path == filepath.Join(dir, snapshotsDir) {
+				return filepath.SkipDir
+			}
+
 			return nil
 		}
 
@@ -213,16 +291,11 @@ func getSessions(dir string) []Session {
 			return nil
 		}
 
-		var thisSession Session
-
-		f, err := os.ReadFile(path)
-		if err != nil {
-			return err
-		}
-
-		err = json.Unmarshal(f, &thisSession)
+		// One bad file shouldn't hide every other session
+		thisSession, err := readSession(path)
 		if err != nil {
-			return err
+			log.Println(err)
+			return nil
 		}
 
 		ret = append(ret, thisSession)
@@ -247,96 +320,233 @@ func lsSessions(sessions []Session) []string {
 	return ret
 }
 
-func sessionCreatePanes(sessNameWin string, window SessWin) error {
-	var err error
+// findSession returns the saved session called name
+func findSession(sessions []Session, name string) (Session, bool) {
+	for _, v := range sessions {
+		if v.Name == name {
+			return v, true
+		}
+	}
+
+	return Session{}, false
+}
+
+// firstPanePath is the directory the window's first pane should start in
+func firstPanePath(window SessWin) string {
+	if len(window.Panes) == 0 {
+		return ""
+	}
+
+	return window.Panes[0].Path
+}
+
+// sessionCreatePanes fills in the window's panes. Scrollback files are
+// relative to base.
+func sessionCreatePanes(sessNameWin string, window SessWin, base string) error {
+	rules, err := restoreRules()
+	if err != nil {
+		return err
+	}
 
 	first := true
 	focus := 0
 
 	for _, p := range window.Panes {
+		// Panes are found by the index tmux gives them, which is only the
+		// saved one if pane-base-index hasn't changed (imported sessions
+		// don't know it at all)
+		var idx int
+
+		// The first pane is created along with the window, in the right
+		// directory already
 		if !first {
-			// start pane with -c for the remainder
-			_, e, err := lib.Tmux(lib.GlobalArgs, "split-window", map[string]string{
-				"-t": sessNameWin,
-				"-c": p.Path,
-			}, "")
+			c := lib.Command("split-window").Flag("-P").Format("#{pane_index}").Target(sessNameWin)
+			if p.Path != "" {
+				c.StartDir(p.Path)
+			}
+
+			o, e, err := c.Run()
 			if err != nil {
-				log.Println(e)
-				return err
+				return fmt.Errorf("pane %d: split-window: %s: %s", p.Index, err, e)
+			}
+
+			idx, err = strconv.Atoi(o)
+			if err != nil {
+				return fmt.Errorf("pane %d: split-window: %s", p.Index, err)
 			}
 		} else {
 			first = false
-			// cd in first pane
-			_, e, err := lib.Tmux(lib.GlobalArgs, "send-keys", map[string]string{
-				"-t": fmt.Sprintf("%s.%d", sessNameWin, p.Index),
-			}, fmt.Sprintf("\"cd %s\" Enter", p.Path))
-			if err != nil {
-				log.Println(e)
-				return err
+
+			panes, err := lib.ListPanes(sessNameWin)
+			if err != nil || len(panes) == 0 {
+				return fmt.Errorf("pane %d: no pane to start from: %v", p.Index, err)
+			}
+
+			idx = panes[0].Index
+			focus = idx
+		}
+
+		target := lib.PaneTarget(sessNameWin, idx)
+
+		if p.Scrollback != "" {
+			file := p.Scrollback
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(base, file)
 			}
 
-			_, e, err = lib.Tmux(lib.GlobalArgs, "send-keys", map[string]string{
-				"-t": fmt.Sprintf("%s.%d", sessNameWin, p.Index),
-			}, "C-l")
+			// Missing history isn't worth failing the whole restore over
+			if _, err := os.Stat(file); err != nil {
+				log.Printf("pane %d: %s", p.Index, err)
+			} else {
+				err := replayScrollback(target, p.Path, file)
+				if err != nil {
+					return fmt.Errorf("pane %d: %s", p.Index, err)
+				}
+			}
+		}
+
+		err := setOptions(target, lib.OptionPane, p.Options)
+		if err != nil {
+			return fmt.Errorf("pane %d: %s", p.Index, err)
+		}
+
+		if p.Title != "" {
+			_, e, err := lib.Command("select-pane").Opt("-T", p.Title).Target(target).Run()
 			if err != nil {
-				log.Println(e)
-				return err
+				return fmt.Errorf("pane %d: select-pane: %s: %s", p.Index, err, e)
 			}
 		}
 
-		if p.Command != "" {
-			_, e, err := lib.Tmux(lib.GlobalArgs, "send-keys", map[string]string{
-				"-t": fmt.Sprintf("%s.%d", sessNameWin, p.Index),
-			}, fmt.Sprintf("\"%s\" Enter", p.Command))
+		command, err := rules.command(window, p)
+		if err != nil {
+			return fmt.Errorf("pane %d: %s", p.Index, err)
+		}
+
+		for _, line := range append(slices.Clone(p.Before), command) {
+			if line == "" {
+				continue
+			}
+
+			err := sendLine(target, line)
 			if err != nil {
-				log.Println(e)
-				return err
+				return fmt.Errorf("pane %d: %s", p.Index, err)
 			}
 		}
 
 		if p.Current {
-			focus = p.Index
+			focus = idx
 		}
 	}
 
-	_, e, err := lib.Tmux(lib.GlobalArgs, "select-pane", map[string]string{
-		"-t": fmt.Sprintf("%s.%d", sessNameWin, focus),
-	}, "")
+	_, e, err := lib.Command("select-pane").Target(lib.PaneTarget(sessNameWin, focus)).Run()
+	if err != nil {
+		return fmt.Errorf("pane %d: select-pane: %s: %s", focus, err, e)
+	}
 
+	return nil
+}
+
+// sendLine types line into the pane at target and presses Enter. The line
+// goes with -l, since even after -- tmux reads a line that happens to be a
+// key name (Home, Tab, F1, ...) as that key.
+func sendLine(target, line string) error {
+	_, e, err := lib.Command("send-keys").Flag("-l").Target(target).Arg("--", line).Run()
 	if err != nil {
-		log.Println(e)
-		return err
+		return fmt.Errorf("send-keys: %s: %s", err, e)
+	}
+
+	_, e, err = lib.Command("send-keys").Target(target).Arg("Enter").Run()
+	if err != nil {
+		return fmt.Errorf("send-keys: %s: %s", err, e)
 	}
 
 	return nil
 }
 
-func sessionCreateWindows(sessName string, windows []SessWin) error {
+// namedLayouts are the layouts select-layout knows by name
+var namedLayouts = []string{"even-horizontal", "even-vertical", "main-horizontal", "main-vertical", "tiled"}
+
+// fitLayout returns the window's saved layout scaled to the size the window
+// at target has now, so it still applies after the terminal changed size
+func fitLayout(target string, window SessWin) (string, error) {
+	// Imported sessions can have no layout or a named one like tiled
+	if window.Layout == "" || slices.Contains(namedLayouts, window.Layout) {
+		return window.Layout, nil
+	}
+
+	l, err := layout.Parse(window.Layout)
+	if err != nil {
+		return "", fmt.Errorf("cmd: fitLayout: %s: %s", target, err)
+	}
+
+	if n := len(l.Panes()); n != len(window.Panes) {
+		return "", fmt.Errorf("cmd: fitLayout: %s: layout has %d panes, window has %d", target, n, len(window.Panes))
+	}
+
+	win, err := lib.GetWindow(target)
+	if err != nil {
+		return "", fmt.Errorf("cmd: fitLayout: %s", err)
+	}
+
+	err = l.Scale(win.Width, win.Height)
+	if err != nil {
+		return "", fmt.Errorf("cmd: fitLayout: %s: %s", target, err)
+	}
+
+	return l.String(), nil
+}
+
+// windowDesc names a window in error messages
+func windowDesc(w SessWin) string {
+	if w.Name == "" {
+		return fmt.Sprintf("window %d", w.Index)
+	}
+
+	return fmt.Sprintf("window %d (%s)", w.Index, w.Name)
+}
+
+func sessionCreateWindows(sessName string, windows []SessWin, base string) error {
 	first := true
 	focus := 0
 
 	for _, w := range windows {
-		target := fmt.Sprintf("%s:%d", sessName, w.Index)
+		target := lib.WindowTarget(sessName, w.Index)
 
 		if !first {
-			_, e, err := lib.Tmux(lib.GlobalArgs, "new-window", map[string]string{
-				"-t": target,
-				"-n": w.Name,
-			}, "")
+			c := lib.Command("new-window").Target(target)
+			if w.Name != "" {
+				c.Opt("-n", w.Name)
+			}
+			if path := firstPanePath(w); path != "" {
+				c.StartDir(path)
+			}
+
+			_, e, err := c.Run()
 			if err != nil {
-				log.Println(e)
-				return err
+				return fmt.Errorf("%s: new-window: %s: %s", windowDesc(w), err, e)
 			}
 		} else {
 			first = false
+			focus = w.Index
+
+			// The window new-session made has whatever index base-index
+			// gave it
+			win, err := lib.GetWindow(lib.ActiveTarget(sessName))
+			if err != nil {
+				return fmt.Errorf("%s: %s", windowDesc(w), err)
+			}
+
+			if win.Index != w.Index {
+				_, e, err := lib.Command("move-window").Source(win.ID).Target(target).Run()
+				if err != nil {
+					return fmt.Errorf("%s: move-window: %s: %s", windowDesc(w), err, e)
+				}
+			}
 
 			if w.Name != "" {
-				_, e, err := lib.Tmux(lib.GlobalArgs, "rename-window", map[string]string{
-					"-t": target,
-				}, w.Name)
+				_, e, err := lib.Command("rename-window").Target(target).Arg(w.Name).Run()
 				if err != nil {
-					log.Println(e)
-					return err
+					return fmt.Errorf("%s: rename-window: %s: %s", windowDesc(w), err, e)
 				}
 			}
 		}
@@ -345,42 +555,149 @@ func sessionCreateWindows(sessName string, windows []SessWin) error {
 			focus = w.Index
 		}
 
-		err := sessionCreatePanes(target, w)
+		err := sessionCreatePanes(target, w, base)
 		if err != nil {
-			return err
+			return fmt.Errorf("%s: %s", windowDesc(w), err)
+		}
+
+		windowLayout, err := fitLayout(target, w)
+		if err != nil {
+			// Leave tmux's own split sizes rather than fail the restore
+			log.Println(err)
+		} else if windowLayout != "" {
+			_, e, err := lib.Command("select-layout").Target(target).Arg(windowLayout).Run()
+			if err != nil {
+				return fmt.Errorf("%s: select-layout: %s: %s", windowDesc(w), err, e)
+			}
+		}
+
+		err = restoreWindowState(target, w)
+		if err != nil {
+			return fmt.Errorf("%s: %s", windowDesc(w), err)
+		}
+	}
+
+	_, e, err := lib.Command("select-window").Target(lib.WindowTarget(sessName, focus)).Run()
+	if err != nil {
+		return fmt.Errorf("window %d: select-window: %s: %s", focus, err, e)
+	}
+
+	return nil
+}
+
+// restoreSession builds session under a temporary name and only gives it its
+// real name once every window and pane is in place. If anything fails, what
+// was built so far is killed.
+func restoreSession(session Session) error {
+	if lib.HasSession(session.Name) {
+		return fmt.Errorf("cmd: restoreSession: session %s already exists", session.Name)
+	}
+
+	tmpName := lib.SessionName(fmt.Sprintf("tmux-tools-restore-%d-%s", os.Getpid(), session.Name))
+
+	c := lib.Command("new-session").Flag("-d").Opt("-s", tmpName)
+	if len(session.Windows) > 0 {
+		if path := firstPanePath(session.Windows[0]); path != "" {
+			c.StartDir(path)
 		}
+	}
+
+	_, e, err := c.Run()
+	if err != nil {
+		return fmt.Errorf("cmd: restoreSession: %s: new-session: %s: %s", session.Name, err, e)
+	}
+
+	rollback := func(err error) error {
+		_, e, kerr := lib.Command("kill-session").Target(lib.SessionTarget(tmpName)).Run()
+		if kerr != nil {
+			log.Printf("cmd: restoreSession: couldn't clean up %s: %s: %s", tmpName, kerr, e)
+		}
+
+		return fmt.Errorf("cmd: restoreSession: %s: %s", session.Name, err)
+	}
+
+	err = restoreSessionState(tmpName, session)
+	if err != nil {
+		return rollback(err)
+	}
+
+	// Scrollback files are relative to the session file, and panes don't
+	// start in our working directory
+	base, err := filepath.Abs(filepath.Dir(session.File))
+	if err != nil {
+		return rollback(err)
+	}
+
+	err = sessionCreateWindows(tmpName, session.Windows, base)
+	if err != nil {
+		return rollback(err)
+	}
 
-		_, e, err := lib.Tmux(lib.GlobalArgs, "select-layout", map[string]string{
-			"-t": target,
-		}, fmt.Sprintf("\"%s\"", w.Layout))
+	_, e, err = lib.Command("rename-session").Target(lib.SessionTarget(tmpName)).Arg(session.Name).Run()
+	if err != nil {
+		return rollback(fmt.Errorf("rename-session: %s: %s", err, e))
+	}
 
+	return nil
+}
+
+// attachSession switches this client to the session, or attaches to it when
+// not run from inside tmux
+func attachSession(name string) {
+	if os.Getenv("TMUX") != "" {
+		_, e, err := lib.Command("switch-client").Target(lib.SessionTarget(name)).Run()
 		if err != nil {
 			log.Println(e)
-			return err
+			log.Fatal(err)
 		}
+
+		return
 	}
 
-	_, _, err := lib.Tmux(lib.GlobalArgs, "select-window", map[string]string{
-		"-t": fmt.Sprintf("%s:%d", sessName, focus),
-	}, "")
+	err := lib.Command("attach").Target(lib.SessionTarget(name)).Exec()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// confirm asks a yes/no question on the terminal. Without a terminal to ask
+// on, the answer is no.
+func confirm(question string) bool {
+	if !lib.IsTerminal(os.Stdin.Fd()) {
+		return false
+	}
+
+	fmt.Printf("%s [y/N] ", question)
 
-	log.Println(err)
-	return err
+	var answer string
+	_, _ = fmt.Scanln(&answer)
+
+	return strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes")
 }
 
 var sessionLoadCmd = &cobra.Command{
 	Use:   "load",
 	Short: "load a session",
 	Run: func(cmd *cobra.Command, args []string) {
-		var err error
+		initGlobalArgs()
+
+		if flagSessionsAll {
+			loadAll()
+			return
+		}
 
-		var session Session
+		if flagSessionsLatest || flagSessionsAt != "" {
+			loadAutosave()
+			return
+		}
+
+		var err error
 
 		sessions := getSessions(flagSessionsDir)
 
 		// if no user provided file or name, load all and start fzf
 		if flagSessionName == "" {
-			flagSessionName, err = lib.Fzf(lsSessions(sessions))
+			flagSessionName, err = fzfSession(sessions)
 			if err != nil {
 				log.Fatal(err)
 			}
@@ -390,53 +707,47 @@ var sessionLoadCmd = &cobra.Command{
 			}
 		}
 
-		for _, v := range sessions {
-			if v.Name == flagSessionName {
-				session = v
-			}
+		session, ok := findSession(sessions, flagSessionName)
+		if !ok {
+			log.Fatalf("no saved session named %s", flagSessionName)
 		}
 
-		_, e, err := lib.Tmux(lib.GlobalArgs, "new-session", map[string]string{
-			"-d": "",
-			"-s": session.Name,
-		}, "")
-		if err != nil {
-			log.Println(e)
-			log.Fatal(err)
-		}
+		loadSession(session)
+	},
+}
 
-		err = sessionCreateWindows(session.Name, session.Windows)
-		if err != nil {
-			log.Fatal(err)
+// loadSession restores session and attaches to it. If it's running already,
+// it asks whether to attach to that instead.
+func loadSession(session Session) {
+	if lib.HasSession(session.Name) {
+		if flagSessionAttach || confirm(fmt.Sprintf("Session %s already exists, attach to it?", session.Name)) {
+			attachSession(session.Name)
+			return
 		}
 
-		if os.Getenv("TMUX") != "" {
-			_, e, err = lib.Tmux(lib.GlobalArgs, "switch-client", map[string]string{
-				"-t": session.Name,
-			}, "")
-			if err != nil {
-				log.Println(e)
-				log.Fatal(err)
-			}
-		} else {
-			_, e, err = lib.Tmux(lib.GlobalArgs, "attach", map[string]string{
-				"-t": session.Name,
-			}, "")
-			if err != nil {
-				log.Println(e)
-				log.Fatal(err)
-			}
-		}
-	},
+		log.Fatalf("session %s already exists", session.Name)
+	}
+
+	err := restoreSession(session)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	attachSession(session.Name)
 }
 
 func init() {
 	rootCmd.AddCommand(sessionCmd)
 
 	sessionCmd.PersistentFlags().StringVarP(&flagSessionName, "name", "n", "", "name of session to save/load")
-	sessionCmd.PersistentFlags().StringVarP(&flagSessionsDir, "dir", "d", xdg.ConfigHome+"/tmux-tools/sessions", "directory to save/load sessions from")
+	sessionCmd.PersistentFlags().StringVarP(&flagSessionsDir, "dir", "d", defaultSessionsDir, "directory to save/load sessions from")
 
 	sessionCmd.AddCommand(sessionSaveCmd)
+	sessionSaveCmd.Flags().BoolVar(&flagSessionsAll, "all", false, "save every session on the server as one snapshot")
+	sessionSaveCmd.Flags().BoolVar(&flagSessionsScrollback, "scrollback", false, "save each pane's scrollback too (config: sessions.scrollback)")
+	sessionSaveCmd.Flags().IntVar(&flagScrollbackLines, "scrollback-lines", defaultScrollbackLines, "how many lines of scrollback to save per pane (config: sessions.scrollback_lines)")
 
 	sessionCmd.AddCommand(sessionLoadCmd)
+	sessionLoadCmd.Flags().BoolVar(&flagSessionsAll, "all", false, "load every session in a snapshot saved with save --all")
+	sessionLoadCmd.Flags().BoolVarP(&flagSessionAttach, "attach", "a", false, "attach to the session if it's already running instead of failing")
 }
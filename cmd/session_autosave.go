@@ -0,0 +1,443 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/distek/tmux-tools/lib"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/sys/unix"
+)
+
+// autosaveDir is where autosave keeps its snapshots, under snapshotsDir
+const autosaveDir = "autosave"
+
+// autosaveStamp names autosave files. It sorts the same as the times do.
+// Files get autosaveFraction on the end too, so saves in the same second
+// don't overwrite each other; parsing with autosaveStamp alone reads names
+// with or without it.
+const (
+	autosaveStamp    = "20060102T150405"
+	autosaveFraction = ".000000"
+)
+
+// How long autosave waits for things to settle after a window or pane change,
+// so opening five panes is one snapshot and not five
+const autosaveSettle = time.Second * 2
+
+const (
+	defaultAutosaveInterval = time.Minute * 15
+	defaultAutosaveKeep     = 10
+)
+
+var (
+	flagAutosaveInterval time.Duration
+	flagAutosaveKeep     int
+	flagAutosaveOnce     bool
+
+	flagSessionsLatest bool
+	flagSessionsAt     string
+)
+
+// autosaveInterval is --interval, then sessions.autosave_interval from the
+// config, then the default. 0 turns the timer off and only saves on changes.
+func autosaveInterval(cmd *cobra.Command) time.Duration {
+	if cmd.Flags().Changed("interval") {
+		return flagAutosaveInterval
+	}
+
+	if viper.IsSet("sessions.autosave_interval") {
+		return viper.GetDuration("sessions.autosave_interval")
+	}
+
+	return defaultAutosaveInterval
+}
+
+// autosaveKeep is --keep, then sessions.autosave_keep, then the default
+func autosaveKeep(cmd *cobra.Command) int {
+	if cmd.Flags().Changed("keep") {
+		return flagAutosaveKeep
+	}
+
+	if viper.IsSet("sessions.autosave_keep") {
+		return viper.GetInt("sessions.autosave_keep")
+	}
+
+	return defaultAutosaveKeep
+}
+
+func autosavePath() string {
+	return filepath.Join(flagSessionsDir, snapshotsDir, autosaveDir)
+}
+
+// autosaveFile is one snapshot written by autosave
+type autosaveFile struct {
+	Path  string
+	Saved time.Time
+}
+
+// listAutosaves returns the autosave snapshots, oldest first
+func listAutosaves() ([]autosaveFile, error) {
+	entries, err := os.ReadDir(autosavePath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("cmd: listAutosaves: %s", err)
+	}
+
+	var ret []autosaveFile
+
+	for _, e := range entries {
+		stamp, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() {
+			continue
+		}
+
+		t, err := time.ParseInLocation(autosaveStamp, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+
+		ret = append(ret, autosaveFile{
+			Path:  filepath.Join(autosavePath(), e.Name()),
+			Saved: t,
+		})
+	}
+
+	slices.SortFunc(ret, func(a, b autosaveFile) int {
+		return a.Saved.Compare(b.Saved)
+	})
+
+	return ret, nil
+}
+
+// sameSnapshot reports whether a and b hold the same sessions, ignoring when
+// they were saved
+func sameSnapshot(a, b ServerSnapshot) bool {
+	strip := func(s ServerSnapshot) []byte {
+		s.Saved = time.Time{}
+		s.Sessions = slices.Clone(s.Sessions)
+
+		for i := range s.Sessions {
+			s.Sessions[i].Saved = time.Time{}
+		}
+
+		b, _ := json.Marshal(s)
+		return b
+	}
+
+	return bytes.Equal(strip(a), strip(b))
+}
+
+// autosave writes a new snapshot unless nothing changed since the last one,
+// then drops the oldest ones past keep
+func autosave(keep int) error {
+	snap, err := captureServer(false)
+	if err != nil {
+		return err
+	}
+
+	files, err := listAutosaves()
+	if err != nil {
+		return err
+	}
+
+	if len(files) > 0 {
+		last, err := readSnapshot(files[len(files)-1].Path)
+		if err == nil && sameSnapshot(last, snap) {
+			return nil
+		}
+	}
+
+	path := filepath.Join(autosavePath(), snap.Saved.Format(autosaveStamp+autosaveFraction)+".json")
+
+	err = writeJSON(path, snap)
+	if err != nil {
+		return fmt.Errorf("cmd: autosave: %s", err)
+	}
+
+	files = append(files, autosaveFile{Path: path, Saved: snap.Saved})
+
+	if keep > 0 && len(files) > keep {
+		for _, f := range files[:len(files)-keep] {
+			err := os.Remove(f.Path)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Println(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// autosaveLock holds the daemon's lock on the autosave directory
+var autosaveLock *os.File
+
+// lockAutosave makes sure only one autosave daemon runs per sessions
+// directory. The lock goes away with the process.
+func lockAutosave() error {
+	err := os.MkdirAll(autosavePath(), 0750)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(autosavePath(), ".lock"), os.O_CREATE|os.O_RDWR, 0640)
+	if err != nil {
+		return err
+	}
+
+	err = unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("autosave is already running for %s", flagSessionsDir)
+	}
+
+	// Keep f (and with it the lock) open for the life of the process
+	autosaveLock = f
+
+	return nil
+}
+
+// Window and layout notifications only cover the session the control client
+// is on, so autosave also subscribes to this, which changes whenever a window
+// or pane comes or goes anywhere on the server
+const autosaveWatchFormat = "#{S:#{session_id}#{W:#{window_id}#{window_panes},};}"
+
+const autosaveWatchName = "tmux-tools-autosave"
+
+// changesLayout reports whether ev means a window or pane came or went
+func changesLayout(ev lib.Event) bool {
+	switch ev := ev.(type) {
+	case lib.WindowAddEvent, lib.LayoutChangeEvent:
+		return true
+	case lib.SubscriptionChangedEvent:
+		return ev.Name == autosaveWatchName
+	case lib.RawEvent:
+		switch ev.Name {
+		case "window-close", "unlinked-window-add", "unlinked-window-close",
+			"window-renamed", "session-renamed", "sessions-changed":
+			return true
+		}
+	}
+
+	return false
+}
+
+var sessionAutosaveCmd = &cobra.Command{
+	Use:   "autosave",
+	Short: "snapshot every session periodically and whenever windows or panes change",
+	Long: `Runs until the tmux server exits, writing snapshots like save --all into
+the snapshots/autosave directory. Restore one with load --latest or --at.
+
+With --once it saves a single snapshot and exits, for use from tmux hooks.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		initGlobalArgs()
+
+		keep := autosaveKeep(cmd)
+
+		if flagAutosaveOnce {
+			err := autosave(keep)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			return
+		}
+
+		err := lockAutosave()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var events <-chan lib.Event
+
+		// Attach to the session used last, so attaching doesn't make some
+		// other session look like the most recent one
+		target := ""
+		if sessions, err := lib.ListSessions(); err == nil {
+			var latest int64 = -1
+			for _, s := range sessions {
+				if s.LastAttached > latest {
+					latest = s.LastAttached
+					target = s.ID
+				}
+			}
+		}
+
+		client, err := lib.Connect(target)
+		if err != nil {
+			log.Printf("not watching for changes: %s", err)
+		} else {
+			defer client.Close()
+
+			var cancel func()
+			events, cancel = client.Subscribe()
+			defer cancel()
+
+			if lib.Supports(lib.FeatureSubscriptions) {
+				err := client.SubscribeFormat(autosaveWatchName, "", autosaveWatchFormat)
+				if err != nil {
+					log.Println(err)
+				}
+			}
+		}
+
+		var tick <-chan time.Time
+		if interval := autosaveInterval(cmd); interval > 0 {
+			t := time.NewTicker(interval)
+			defer t.Stop()
+
+			tick = t.C
+		} else if events == nil {
+			log.Fatal("no interval and no way to watch for changes, nothing to do")
+		}
+
+		settle := time.NewTimer(autosaveSettle)
+		settle.Stop()
+
+		save := func() {
+			err := autosave(keep)
+			if err != nil {
+				log.Println(err)
+			}
+		}
+
+		save()
+
+		for {
+			select {
+			case <-tick:
+				// Without a control client there's no %exit when the
+				// server goes away, so check it's still there
+				if events == nil {
+					if _, err := lib.ListSessions(); err != nil {
+						log.Printf("tmux server gone, stopping: %s", err)
+						return
+					}
+				}
+
+				save()
+			case <-settle.C:
+				save()
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+
+				if _, ok := ev.(lib.ExitEvent); ok {
+					return
+				}
+
+				if changesLayout(ev) {
+					settle.Reset(autosaveSettle)
+				}
+			}
+		}
+	},
+}
+
+// parseAt reads the --at time. Times without a date are today.
+func parseAt(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, time.DateTime, "2006-01-02 15:04", time.DateOnly, autosaveStamp} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	for _, layout := range []string{time.TimeOnly, "15:04"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			now := time.Now()
+			return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("can't read %q as a time, try \"2006-01-02 15:04\" or \"15:04\"", s)
+}
+
+// pickAutosave returns the newest autosave, or with at set, the newest one
+// saved at or before it
+func pickAutosave(at string) (autosaveFile, error) {
+	files, err := listAutosaves()
+	if err != nil {
+		return autosaveFile{}, err
+	}
+
+	if len(files) == 0 {
+		return autosaveFile{}, fmt.Errorf("no autosaves in %s", autosavePath())
+	}
+
+	if at == "" {
+		return files[len(files)-1], nil
+	}
+
+	t, err := parseAt(at)
+	if err != nil {
+		return autosaveFile{}, err
+	}
+
+	for i := len(files) - 1; i >= 0; i-- {
+		if !files[i].Saved.After(t) {
+			return files[i], nil
+		}
+	}
+
+	return autosaveFile{}, fmt.Errorf("no autosave from before %s, the oldest is from %s", t.Format(time.DateTime), files[0].Saved.Format(time.DateTime))
+}
+
+// loadAutosave restores the autosave picked by --latest/--at: every session
+// in it, or just the one named with --name
+func loadAutosave() {
+	f, err := pickAutosave(flagSessionsAt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	snap, err := readSnapshot(f.Path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("restoring autosave from %s", f.Saved.Format(time.DateTime))
+
+	if flagSessionName == "" {
+		restoreServer(snap)
+		return
+	}
+
+	session := mustFindSession(snap.Sessions, flagSessionName)
+
+	if lib.HasSession(session.Name) {
+		log.Fatalf("session %s already exists", session.Name)
+	}
+
+	err = restoreSession(session)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	attachSession(session.Name)
+}
+
+func init() {
+	sessionCmd.AddCommand(sessionAutosaveCmd)
+
+	sessionAutosaveCmd.Flags().DurationVar(&flagAutosaveInterval, "interval", defaultAutosaveInterval, "how often to save, 0 to only save on changes (config: sessions.autosave_interval)")
+	sessionAutosaveCmd.Flags().IntVar(&flagAutosaveKeep, "keep", defaultAutosaveKeep, "how many snapshots to keep, 0 for all of them (config: sessions.autosave_keep)")
+	sessionAutosaveCmd.Flags().BoolVar(&flagAutosaveOnce, "once", false, "save one snapshot and exit")
+
+	sessionLoadCmd.Flags().BoolVar(&flagSessionsLatest, "latest", false, "load the newest autosave")
+	sessionLoadCmd.Flags().StringVar(&flagSessionsAt, "at", "", "load the newest autosave from before this time")
+	sessionLoadCmd.MarkFlagsMutuallyExclusive("latest", "at", "all")
+}
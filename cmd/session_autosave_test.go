@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAutosaveSameSecond(t *testing.T) {
+	fakeServer(t)
+
+	old := flagSessionsDir
+	flagSessionsDir = t.TempDir()
+	t.Cleanup(func() { flagSessionsDir = old })
+
+	// One from before names had a fraction in them
+	err := os.MkdirAll(autosavePath(), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(autosavePath(), "20240501T133000.json"), []byte(`{"version": 1}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmux(t, "new-session", "-d", "-s", "a")
+
+	err = autosave(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmux(t, "new-session", "-d", "-s", "b")
+
+	err = autosave(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := listAutosaves()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 3 {
+		t.Fatalf("got %d autosaves, want 3: %+v", len(files), files)
+	}
+
+	if want := time.Date(2024, 5, 1, 13, 30, 0, 0, time.Local); !files[0].Saved.Equal(want) {
+		t.Errorf("oldest is from %s, want %s", files[0].Saved, want)
+	}
+
+	last, err := readSnapshot(files[2].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(last.Sessions) != 2 {
+		t.Errorf("newest autosave has %d sessions, want 2", len(last.Sessions))
+	}
+}
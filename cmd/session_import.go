@@ -0,0 +1,705 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/distek/tmux-tools/lib"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// The project file formats import and export know
+const (
+	formatTmuxinator = "tmuxinator"
+	formatTmuxp      = "tmuxp"
+)
+
+var (
+	flagImportFrom   string
+	flagExportTo     string
+	flagExportOutput string
+)
+
+// tmuxinatorProject is a tmuxinator project file. Windows are one-key maps of
+// the window name to a command, a list of commands, or a tmuxinatorWindow.
+type tmuxinatorProject struct {
+	Name          string           `yaml:"name"`
+	Root          string           `yaml:"root,omitempty"`
+	PreWindow     any              `yaml:"pre_window,omitempty"`
+	PreTab        any              `yaml:"pre_tab,omitempty"`
+	StartupWindow any              `yaml:"startup_window,omitempty"`
+	StartupPane   *int             `yaml:"startup_pane,omitempty"`
+	Windows       []map[string]any `yaml:"windows"`
+}
+
+// tmuxinatorWindow is the long form of a tmuxinator window. Panes are a
+// command, a list of commands, or a one-key map of the pane's title to
+// either.
+type tmuxinatorWindow struct {
+	Root   string `yaml:"root,omitempty"`
+	Layout string `yaml:"layout,omitempty"`
+	Pre    any    `yaml:"pre,omitempty"`
+	Panes  []any  `yaml:"panes,omitempty"`
+}
+
+// tmuxpConfig is a tmuxp workspace file, YAML or JSON
+type tmuxpConfig struct {
+	SessionName        string            `yaml:"session_name" json:"session_name"`
+	StartDirectory     string            `yaml:"start_directory,omitempty" json:"start_directory,omitempty"`
+	ShellCommandBefore any               `yaml:"shell_command_before,omitempty" json:"shell_command_before,omitempty"`
+	Environment        map[string]string `yaml:"environment,omitempty" json:"environment,omitempty"`
+	Options            map[string]any    `yaml:"options,omitempty" json:"options,omitempty"`
+	Windows            []tmuxpWindow     `yaml:"windows" json:"windows"`
+}
+
+// tmuxpWindow is a window in a tmuxp workspace. Panes are a command, null for
+// a plain shell, or a tmuxpPane.
+type tmuxpWindow struct {
+	WindowName         string         `yaml:"window_name,omitempty" json:"window_name,omitempty"`
+	Layout             string         `yaml:"layout,omitempty" json:"layout,omitempty"`
+	StartDirectory     string         `yaml:"start_directory,omitempty" json:"start_directory,omitempty"`
+	ShellCommandBefore any            `yaml:"shell_command_before,omitempty" json:"shell_command_before,omitempty"`
+	Focus              any            `yaml:"focus,omitempty" json:"focus,omitempty"`
+	Options            map[string]any `yaml:"options,omitempty" json:"options,omitempty"`
+	Panes              []any          `yaml:"panes" json:"panes"`
+}
+
+type tmuxpPane struct {
+	ShellCommand   []string `yaml:"shell_command,omitempty" json:"shell_command,omitempty"`
+	StartDirectory string   `yaml:"start_directory,omitempty" json:"start_directory,omitempty"`
+	Focus          bool     `yaml:"focus,omitempty" json:"focus,omitempty"`
+}
+
+// commandList reads a command or a list of them. tmuxp also has {cmd: ...}
+// items.
+func commandList(v any) []string {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		if v == "" {
+			return nil
+		}
+
+		return []string{v}
+	case []any:
+		var ret []string
+		for _, item := range v {
+			ret = append(ret, commandList(item)...)
+		}
+
+		return ret
+	case map[string]any:
+		return commandList(v["cmd"])
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+// truthy is a YAML or JSON flag that might be a bool or a string
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(v)
+		return b
+	}
+
+	return false
+}
+
+// expandPath expands environment variables and ~ in path, and makes it
+// relative to root. An empty path is root.
+func expandPath(path, root string) string {
+	if path == "" {
+		return root
+	}
+
+	path = os.ExpandEnv(path)
+
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	}
+
+	if !filepath.IsAbs(path) && root != "" {
+		path = filepath.Join(root, path)
+	}
+
+	return path
+}
+
+// optionValues turns option values from a project file into what set-option
+// takes
+func optionValues(opts map[string]any) map[string]string {
+	if len(opts) == 0 {
+		return nil
+	}
+
+	ret := make(map[string]string, len(opts))
+
+	for name, v := range opts {
+		switch v := v.(type) {
+		case bool:
+			ret[name] = "off"
+			if v {
+				ret[name] = "on"
+			}
+		case nil:
+		default:
+			ret[name] = fmt.Sprint(v)
+		}
+	}
+
+	return ret
+}
+
+// importIndexes are the base-index and pane-base-index to number imported
+// windows and panes from: the server's, or tmux's defaults without one
+func importIndexes() (int, int) {
+	index := func(flags, name string) int {
+		o, _, err := lib.Command("show-options").Flag(flags).Arg(name).Run()
+		if err != nil {
+			return 0
+		}
+
+		n, _ := strconv.Atoi(o)
+		return n
+	}
+
+	return index("-gv", "base-index"), index("-gwv", "pane-base-index")
+}
+
+// importPane makes a pane from a list of commands. The last one is the
+// pane's command and the rest run before it.
+func importPane(index int, path string, before, cmds []string) SessPane {
+	p := SessPane{
+		Index:  index,
+		Path:   path,
+		Before: slices.Clone(before),
+	}
+
+	if len(cmds) > 0 {
+		p.Before = append(p.Before, cmds[:len(cmds)-1]...)
+		p.Command = cmds[len(cmds)-1]
+	}
+
+	return p
+}
+
+// focusFirst marks the first window and pane current when the file didn't
+// say which
+func focusFirst(s *Session) {
+	if len(s.Windows) == 0 {
+		return
+	}
+
+	if !slices.ContainsFunc(s.Windows, func(w SessWin) bool { return w.Current }) {
+		s.Windows[0].Current = true
+	}
+
+	for i := range s.Windows {
+		w := &s.Windows[i]
+
+		if len(w.Panes) > 0 && !slices.ContainsFunc(w.Panes, func(p SessPane) bool { return p.Current }) {
+			w.Panes[0].Current = true
+		}
+	}
+}
+
+func importTmuxinator(data []byte) (Session, error) {
+	var proj tmuxinatorProject
+
+	err := yaml.Unmarshal(data, &proj)
+	if err != nil {
+		return Session{}, err
+	}
+
+	winBase, paneBase := importIndexes()
+
+	root := expandPath(proj.Root, "")
+
+	pre := commandList(proj.PreWindow)
+	if pre == nil {
+		pre = commandList(proj.PreTab)
+	}
+
+	session := Session{Name: proj.Name}
+
+	for i, entry := range proj.Windows {
+		if len(entry) != 1 {
+			return Session{}, fmt.Errorf("window %d: should be one name with its settings", i)
+		}
+
+		for name, v := range entry {
+			w := SessWin{
+				Index: winBase + i,
+				Name:  name,
+			}
+
+			var win tmuxinatorWindow
+
+			switch v := v.(type) {
+			case map[string]any:
+				// Round trip through YAML to read the long form
+				b, err := yaml.Marshal(v)
+				if err != nil {
+					return Session{}, fmt.Errorf("window %s: %s", name, err)
+				}
+
+				err = yaml.Unmarshal(b, &win)
+				if err != nil {
+					return Session{}, fmt.Errorf("window %s: %s", name, err)
+				}
+			default:
+				// A command or list of commands for a single pane
+				win.Panes = []any{v}
+			}
+
+			if len(win.Panes) == 0 {
+				win.Panes = []any{nil}
+			}
+
+			w.Layout = win.Layout
+			path := expandPath(win.Root, root)
+			before := append(slices.Clone(pre), commandList(win.Pre)...)
+
+			for j, pv := range win.Panes {
+				title := ""
+
+				// {title: commands}
+				if m, ok := pv.(map[string]any); ok && len(m) == 1 {
+					for k, cmds := range m {
+						title, pv = k, cmds
+					}
+				}
+
+				p := importPane(paneBase+j, path, before, commandList(pv))
+				p.Title = title
+
+				w.Panes = append(w.Panes, p)
+			}
+
+			session.Windows = append(session.Windows, w)
+		}
+	}
+
+	// startup_window is a window name or index
+	if proj.StartupWindow != nil {
+		want := fmt.Sprint(proj.StartupWindow)
+
+		for i := range session.Windows {
+			w := &session.Windows[i]
+
+			if w.Name == want || strconv.Itoa(w.Index) == want {
+				w.Current = true
+
+				if proj.StartupPane != nil {
+					for j := range w.Panes {
+						w.Panes[j].Current = w.Panes[j].Index == *proj.StartupPane
+					}
+				}
+
+				break
+			}
+		}
+	}
+
+	focusFirst(&session)
+
+	return session, nil
+}
+
+func importTmuxp(data []byte, dir string) (Session, error) {
+	var conf tmuxpConfig
+
+	// JSON is YAML too
+	err := yaml.Unmarshal(data, &conf)
+	if err != nil {
+		return Session{}, err
+	}
+
+	winBase, paneBase := importIndexes()
+
+	// tmuxp reads relative start directories from where the file is
+	root := expandPath(conf.StartDirectory, dir)
+
+	session := Session{
+		Name:        conf.SessionName,
+		Environment: conf.Environment,
+		Options:     optionValues(conf.Options),
+	}
+
+	for i, win := range conf.Windows {
+		w := SessWin{
+			Index:   winBase + i,
+			Name:    win.WindowName,
+			Layout:  win.Layout,
+			Current: truthy(win.Focus),
+			Options: optionValues(win.Options),
+		}
+
+		path := expandPath(win.StartDirectory, root)
+		before := append(commandList(conf.ShellCommandBefore), commandList(win.ShellCommandBefore)...)
+
+		panes := win.Panes
+		if len(panes) == 0 {
+			panes = []any{nil}
+		}
+
+		for j, pv := range panes {
+			var p SessPane
+
+			switch pv := pv.(type) {
+			case map[string]any:
+				dir, _ := pv["start_directory"].(string)
+
+				p = importPane(paneBase+j, expandPath(dir, path), before, commandList(pv["shell_command"]))
+				p.Current = truthy(pv["focus"])
+			case string:
+				// tmuxp's names for an empty pane
+				if pv == "blank" || pv == "pane" {
+					pv = ""
+				}
+
+				p = importPane(paneBase+j, path, before, commandList(pv))
+			default:
+				p = importPane(paneBase+j, path, before, commandList(pv))
+			}
+
+			w.Panes = append(w.Panes, p)
+		}
+
+		session.Windows = append(session.Windows, w)
+	}
+
+	focusFirst(&session)
+
+	return session, nil
+}
+
+// paneCommand is the pane's command line as it was saved
+func paneCommand(p SessPane) string {
+	if len(p.Argv) > 0 {
+		return lib.ShellJoin(p.Argv)
+	}
+
+	return p.Command
+}
+
+// commonBefore is the start of Before every pane in the session shares, so
+// it can be written once for the whole project
+func commonBefore(s Session) []string {
+	var ret []string
+
+	first := true
+
+	for _, w := range s.Windows {
+		for _, p := range w.Panes {
+			if first {
+				ret, first = p.Before, false
+				continue
+			}
+
+			n := 0
+			for n < len(ret) && n < len(p.Before) && ret[n] == p.Before[n] {
+				n++
+			}
+
+			ret = ret[:n]
+		}
+	}
+
+	return ret
+}
+
+// sessionRoot is the directory the session starts in
+func sessionRoot(s Session) string {
+	if len(s.Windows) == 0 {
+		return ""
+	}
+
+	return firstPanePath(s.Windows[0])
+}
+
+// oneOrMany is a single command as a string and more as a list, the way
+// people write them by hand
+func oneOrMany(cmds []string) any {
+	switch len(cmds) {
+	case 0:
+		return nil
+	case 1:
+		return cmds[0]
+	default:
+		return cmds
+	}
+}
+
+func exportTmuxinator(s Session) tmuxinatorProject {
+	root := sessionRoot(s)
+	pre := commonBefore(s)
+
+	proj := tmuxinatorProject{
+		Name:      s.Name,
+		Root:      root,
+		PreWindow: oneOrMany(pre),
+	}
+
+	for _, w := range s.Windows {
+		name := w.Name
+		if name == "" {
+			name = strconv.Itoa(w.Index)
+		}
+
+		win := tmuxinatorWindow{Layout: w.Layout}
+
+		winRoot := firstPanePath(w)
+		if winRoot != root {
+			win.Root = winRoot
+		}
+
+		for _, p := range w.Panes {
+			// tmuxinator panes all start in the window's root
+			var cmds []string
+			if p.Path != winRoot {
+				cmds = append(cmds, "cd "+lib.ShellQuote(p.Path))
+			}
+
+			cmds = append(cmds, p.Before[len(pre):]...)
+			if c := paneCommand(p); c != "" {
+				cmds = append(cmds, c)
+			}
+
+			var pane any = oneOrMany(cmds)
+			if p.Title != "" {
+				pane = map[string]any{p.Title: pane}
+			}
+
+			win.Panes = append(win.Panes, pane)
+
+			if w.Current && p.Current {
+				proj.StartupWindow = name
+				proj.StartupPane = &p.Index
+			}
+		}
+
+		proj.Windows = append(proj.Windows, map[string]any{name: win})
+	}
+
+	return proj
+}
+
+func exportTmuxp(s Session) tmuxpConfig {
+	root := sessionRoot(s)
+	pre := commonBefore(s)
+
+	conf := tmuxpConfig{
+		SessionName:        s.Name,
+		StartDirectory:     root,
+		ShellCommandBefore: oneOrMany(pre),
+		Environment:        s.Environment,
+	}
+
+	for name, v := range s.Options {
+		if conf.Options == nil {
+			conf.Options = make(map[string]any)
+		}
+
+		conf.Options[name] = v
+	}
+
+	for _, w := range s.Windows {
+		win := tmuxpWindow{
+			WindowName: w.Name,
+			Layout:     w.Layout,
+		}
+
+		if w.Current {
+			win.Focus = true
+		}
+
+		for name, v := range w.Options {
+			if win.Options == nil {
+				win.Options = make(map[string]any)
+			}
+
+			win.Options[name] = v
+		}
+
+		winRoot := firstPanePath(w)
+		if winRoot != root {
+			win.StartDirectory = winRoot
+		}
+
+		for _, p := range w.Panes {
+			pane := tmuxpPane{
+				ShellCommand: slices.Clone(p.Before[len(pre):]),
+				Focus:        p.Current && len(w.Panes) > 1,
+			}
+
+			if c := paneCommand(p); c != "" {
+				pane.ShellCommand = append(pane.ShellCommand, c)
+			}
+
+			if p.Path != winRoot {
+				pane.StartDirectory = p.Path
+			}
+
+			// null is a plain shell
+			if pane.ShellCommand == nil && pane.StartDirectory == "" && !pane.Focus {
+				win.Panes = append(win.Panes, nil)
+				continue
+			}
+
+			win.Panes = append(win.Panes, pane)
+		}
+
+		conf.Windows = append(conf.Windows, win)
+	}
+
+	return conf
+}
+
+var sessionImportCmd = &cobra.Command{
+	Use:   "import --from tmuxinator|tmuxp <file>",
+	Short: "import a tmuxinator or tmuxp project as a saved session",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initGlobalArgs()
+
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var session Session
+
+		switch flagImportFrom {
+		case formatTmuxinator:
+			session, err = importTmuxinator(data)
+		case formatTmuxp:
+			session, err = importTmuxp(data, filepath.Dir(args[0]))
+		default:
+			log.Fatalf("--from should be %s or %s", formatTmuxinator, formatTmuxp)
+		}
+
+		if err != nil {
+			log.Fatalf("%s: %s", args[0], err)
+		}
+
+		if flagSessionName != "" {
+			session.Name = flagSessionName
+		}
+
+		if session.Name == "" {
+			session.Name = strings.TrimSuffix(filepath.Base(args[0]), filepath.Ext(args[0]))
+		}
+
+		if strings.ContainsRune(session.Name, os.PathSeparator) {
+			log.Fatalf("session names can't contain %c", os.PathSeparator)
+		}
+
+		session.Version = schemaVersion
+		session.Saved = time.Now()
+
+		path := filepath.Join(flagSessionsDir, session.Name+".json")
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			log.Fatalf("%s already exists, use --name to import it as something else", path)
+		}
+
+		err = writeJSON(path, session)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		session.File = path
+
+		if flagSessionsJSON {
+			printJSON(summarize(session))
+		}
+	},
+}
+
+var sessionExportCmd = &cobra.Command{
+	Use:   "export --to tmuxinator|tmuxp [name]",
+	Short: "export a saved session as a tmuxinator or tmuxp project",
+	Long: `Writes the project to stdout, or to --output. tmuxp projects are written
+as JSON when the output file ends in .json, YAML otherwise.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var project any
+
+		switch flagExportTo {
+		case formatTmuxinator, formatTmuxp:
+		default:
+			log.Fatalf("--to should be %s or %s", formatTmuxinator, formatTmuxp)
+		}
+
+		sessions := getSessions(flagSessionsDir)
+
+		name := pickSession(args, sessions)
+		if name == "" {
+			return
+		}
+
+		session := mustFindSession(sessions, name)
+
+		if flagExportTo == formatTmuxinator {
+			project = exportTmuxinator(session)
+		} else {
+			project = exportTmuxp(session)
+		}
+
+		var out io.Writer = os.Stdout
+
+		if flagExportOutput != "" {
+			f, err := os.Create(flagExportOutput)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+
+			out = f
+		}
+
+		var err error
+
+		if flagExportTo == formatTmuxp && strings.HasSuffix(flagExportOutput, ".json") {
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(project)
+		} else {
+			enc := yaml.NewEncoder(out)
+			enc.SetIndent(2)
+			err = enc.Encode(project)
+		}
+
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	sessionCmd.AddCommand(sessionImportCmd)
+	sessionImportCmd.Flags().StringVar(&flagImportFrom, "from", "", "format of the file: tmuxinator or tmuxp")
+	sessionImportCmd.Flags().BoolVar(&flagSessionsJSON, "json", false, "print JSON")
+	_ = sessionImportCmd.MarkFlagRequired("from")
+
+	sessionCmd.AddCommand(sessionExportCmd)
+	sessionExportCmd.Flags().StringVar(&flagExportTo, "to", "", "format to write: tmuxinator or tmuxp")
+	sessionExportCmd.Flags().StringVarP(&flagExportOutput, "output", "o", "", "file to write instead of stdout")
+	_ = sessionExportCmd.MarkFlagRequired("to")
+}
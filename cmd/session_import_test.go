@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestTmuxinator(t *testing.T) {
+	fakeServer(t)
+
+	tests := []struct {
+		name string
+		file string
+		want Session
+	}{
+		{
+			name: "long form",
+			file: `
+name: api
+root: /src/api
+pre_window: nvm use
+startup_window: logs
+startup_pane: 1
+windows:
+  - editor: nvim
+  - server:
+      layout: even-horizontal
+      pre:
+        - source .env
+      panes:
+        - go run .
+        - - make build
+          - ./api
+        - tests: go test ./...
+  - logs:
+      root: /var/log
+      panes:
+        - tail -f api.log
+        - errors:
+            - cd api
+            - tail -f error.log
+        -
+`,
+			want: Session{
+				Name: "api",
+				Windows: []SessWin{
+					{
+						Index: 0,
+						Name:  "editor",
+						Panes: []SessPane{
+							{Index: 0, Path: "/src/api", Before: []string{"nvm use"}, Command: "nvim", Current: true},
+						},
+					},
+					{
+						Index:  1,
+						Name:   "server",
+						Layout: "even-horizontal",
+						Panes: []SessPane{
+							{Index: 0, Path: "/src/api", Before: []string{"nvm use", "source .env"}, Command: "go run .", Current: true},
+							{Index: 1, Path: "/src/api", Before: []string{"nvm use", "source .env", "make build"}, Command: "./api"},
+							{Index: 2, Path: "/src/api", Before: []string{"nvm use", "source .env"}, Command: "go test ./...", Title: "tests"},
+						},
+					},
+					{
+						Index:   2,
+						Name:    "logs",
+						Current: true,
+						Panes: []SessPane{
+							{Index: 0, Path: "/var/log", Before: []string{"nvm use"}, Command: "tail -f api.log"},
+							{Index: 1, Path: "/var/log", Before: []string{"nvm use", "cd api"}, Command: "tail -f error.log", Title: "errors", Current: true},
+							{Index: 2, Path: "/var/log", Before: []string{"nvm use"}},
+						},
+					},
+				},
+			},
+		},
+		{
+			// pre_window as a list, startup_window as an index
+			name: "short form",
+			file: `
+name: small
+root: /src
+pre_window:
+  - a
+  - b
+startup_window: 1
+windows:
+  - one: ls
+  - two:
+      - echo hi
+      - top
+`,
+			want: Session{
+				Name: "small",
+				Windows: []SessWin{
+					{
+						Index: 0,
+						Name:  "one",
+						Panes: []SessPane{
+							{Index: 0, Path: "/src", Before: []string{"a", "b"}, Command: "ls", Current: true},
+						},
+					},
+					{
+						Index:   1,
+						Name:    "two",
+						Current: true,
+						Panes: []SessPane{
+							{Index: 0, Path: "/src", Before: []string{"a", "b", "echo hi"}, Command: "top", Current: true},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := importTmuxinator([]byte(tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("import:\ngot  %+v\nwant %+v", got, tt.want)
+			}
+
+			proj := exportTmuxinator(got)
+
+			b, err := yaml.Marshal(proj)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			again, err := importTmuxinator(b)
+			if err != nil {
+				t.Fatalf("%s\n%s", err, b)
+			}
+
+			if !reflect.DeepEqual(again, tt.want) {
+				t.Errorf("round trip:\ngot  %+v\nwant %+v\n%s", again, tt.want, b)
+			}
+		})
+	}
+
+	// A single command or pre comes out as a string, more as a list
+	proj := exportTmuxinator(Session{
+		Name: "x",
+		Windows: []SessWin{{
+			Name: "w",
+			Panes: []SessPane{
+				{Index: 0, Path: "/x", Before: []string{"a"}, Command: "ls"},
+				{Index: 1, Path: "/x", Before: []string{"a", "b"}, Command: "top", Current: true},
+			},
+			Current: true,
+		}},
+	})
+
+	win, _ := proj.Windows[0]["w"].(tmuxinatorWindow)
+
+	switch {
+	case proj.PreWindow != "a":
+		t.Errorf("pre_window: got %#v", proj.PreWindow)
+	case proj.StartupWindow != "w" || proj.StartupPane == nil || *proj.StartupPane != 1:
+		t.Errorf("startup: got %v, %v", proj.StartupWindow, proj.StartupPane)
+	case !reflect.DeepEqual(win.Panes, []any{"ls", []string{"b", "top"}}):
+		t.Errorf("panes: got %#v", win.Panes)
+	}
+}
+
+func TestTmuxp(t *testing.T) {
+	fakeServer(t)
+
+	file := `
+session_name: web
+start_directory: ./web
+shell_command_before: source env/bin/activate
+environment:
+  DEBUG: "1"
+options:
+  mouse: true
+windows:
+  - window_name: edit
+    panes:
+      - vim
+      - null
+      - blank
+  - window_name: serve
+    layout: main-vertical
+    start_directory: /srv
+    focus: true
+    shell_command_before:
+      - cd app
+    options:
+      automatic-rename: false
+    panes:
+      - shell_command:
+          - make
+          - ./serve
+      - shell_command: tail -f log
+        start_directory: logs
+        focus: true
+`
+
+	before := []string{"source env/bin/activate"}
+
+	want := Session{
+		Name:        "web",
+		Environment: map[string]string{"DEBUG": "1"},
+		Options:     map[string]string{"mouse": "on"},
+		Windows: []SessWin{
+			{
+				Index: 0,
+				Name:  "edit",
+				Panes: []SessPane{
+					{Index: 0, Path: "/proj/web", Before: before, Command: "vim", Current: true},
+					{Index: 1, Path: "/proj/web", Before: before},
+					{Index: 2, Path: "/proj/web", Before: before},
+				},
+			},
+			{
+				Index:   1,
+				Name:    "serve",
+				Layout:  "main-vertical",
+				Current: true,
+				Options: map[string]string{"automatic-rename": "off"},
+				Panes: []SessPane{
+					{Index: 0, Path: "/srv", Before: []string{"source env/bin/activate", "cd app", "make"}, Command: "./serve"},
+					{Index: 1, Path: "/srv/logs", Before: []string{"source env/bin/activate", "cd app"}, Command: "tail -f log", Current: true},
+				},
+			},
+		},
+	}
+
+	got, err := importTmuxp([]byte(file), "/proj")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("import:\ngot  %+v\nwant %+v", got, want)
+	}
+
+	conf := exportTmuxp(got)
+
+	if conf.ShellCommandBefore != "source env/bin/activate" || conf.StartDirectory != "/proj/web" {
+		t.Errorf("session: got %+v", conf)
+	}
+
+	// tmuxp takes either, and export writes both
+	for name, marshal := range map[string]func(any) ([]byte, error){"yaml": yaml.Marshal, "json": json.Marshal} {
+		t.Run(name, func(t *testing.T) {
+			b, err := marshal(conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The directory only matters for relative paths, which export
+			// doesn't write
+			again, err := importTmuxp(b, "/elsewhere")
+			if err != nil {
+				t.Fatalf("%s\n%s", err, b)
+			}
+
+			if !reflect.DeepEqual(again, want) {
+				t.Errorf("round trip:\ngot  %+v\nwant %+v\n%s", again, want, b)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/distek/tmux-tools/lib"
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagSessionsJSON bool
+	flagShowFile     bool
+)
+
+// sessionSummary is one line of `sessions list`
+type sessionSummary struct {
+	Name    string    `json:"name"`
+	Windows int       `json:"windows"`
+	Panes   int       `json:"panes"`
+	Saved   time.Time `json:"saved"`
+	File    string    `json:"file"`
+}
+
+func summarize(s Session) sessionSummary {
+	ret := sessionSummary{
+		Name:    s.Name,
+		Windows: len(s.Windows),
+		Saved:   s.Saved,
+		File:    s.File,
+	}
+
+	for _, w := range s.Windows {
+		ret.Panes += len(w.Panes)
+	}
+
+	return ret
+}
+
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	err := enc.Encode(v)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// pickSession is the session named by the first arg, --name, or picked with
+// fzf, in that order. An empty name means nothing was picked.
+func pickSession(args []string, sessions []Session) string {
+	if len(args) > 0 {
+		return args[0]
+	}
+
+	if flagSessionName != "" {
+		return flagSessionName
+	}
+
+	name, err := fzfSession(sessions)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return name
+}
+
+// fzfSession picks one of sessions with fzf, previewing the highlighted
+// one's windows and panes with `sessions show`
+func fzfSession(sessions []Session) (string, error) {
+	opts := []lib.FzfOption{lib.FzfFlags("--prompt", "session> ")}
+
+	if exe, err := os.Executable(); err == nil {
+		preview := fmt.Sprintf("%s sessions show --file --dir %s -- {}", lib.ShellQuote(exe), lib.ShellQuote(flagSessionsDir))
+		opts = append(opts, lib.FzfPreview(preview), lib.FzfFlags("--preview-window", "right:60%"))
+	}
+
+	return lib.Fzf(lsSessions(sessions), opts...)
+}
+
+// mustFindSession is findSession that exits if there's no such session
+func mustFindSession(sessions []Session, name string) Session {
+	session, ok := findSession(sessions, name)
+	if !ok {
+		log.Fatalf("no saved session named %s", name)
+	}
+
+	return session
+}
+
+var sessionListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "list saved sessions",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		sessions := getSessions(flagSessionsDir)
+
+		summaries := make([]sessionSummary, 0, len(sessions))
+		for _, s := range sessions {
+			summaries = append(summaries, summarize(s))
+		}
+
+		if flagSessionsJSON {
+			printJSON(summaries)
+			return
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tWINDOWS\tPANES\tSAVED")
+
+		for _, s := range summaries {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", s.Name, s.Windows, s.Panes, s.Saved.Format(time.DateTime))
+		}
+
+		_ = tw.Flush()
+	},
+}
+
+// printSessionTree prints the session's windows and panes as a tree. Current
+// windows and panes are marked with a '*'.
+func printSessionTree(s Session) {
+	fmt.Printf("%s (saved %s)\n", s.Name, s.Saved.Format(time.DateTime))
+
+	mark := func(current bool) string {
+		if current {
+			return " *"
+		}
+
+		return ""
+	}
+
+	for i, w := range s.Windows {
+		branch, indent := "├── ", "│   "
+		if i == len(s.Windows)-1 {
+			branch, indent = "└── ", "    "
+		}
+
+		name := w.Name
+		if name == "" {
+			name = "(automatic)"
+		}
+
+		fmt.Printf("%s%d: %s%s\n", branch, w.Index, name, mark(w.Current))
+
+		for j, p := range w.Panes {
+			paneBranch := "├── "
+			if j == len(w.Panes)-1 {
+				paneBranch = "└── "
+			}
+
+			line := fmt.Sprintf("%d: %s", p.Index, p.Path)
+			if p.Command != "" {
+				line += "  " + p.Command
+			}
+
+			fmt.Printf("%s%s%s%s\n", indent, paneBranch, line, mark(p.Current))
+		}
+	}
+}
+
+var sessionShowCmd = &cobra.Command{
+	Use:   "show [name]",
+	Short: "show the windows and panes in a saved session",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		sessions := getSessions(flagSessionsDir)
+
+		name := pickSession(args, sessions)
+		if name == "" {
+			return
+		}
+
+		session := mustFindSession(sessions, name)
+
+		if flagSessionsJSON {
+			printJSON(session)
+			return
+		}
+
+		printSessionTree(session)
+
+		if flagShowFile {
+			fmt.Printf("\n%s\n", tildePath(session.File))
+		}
+	},
+}
+
+var sessionRenameCmd = &cobra.Command{
+	Use:   "rename <name> <new name>",
+	Short: "rename a saved session",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		sessions := getSessions(flagSessionsDir)
+
+		session := mustFindSession(sessions, args[0])
+		newName := args[1]
+
+		if strings.ContainsRune(newName, os.PathSeparator) {
+			log.Fatalf("session names can't contain %c", os.PathSeparator)
+		}
+
+		if _, ok := findSession(sessions, newName); ok {
+			log.Fatalf("a saved session named %s already exists", newName)
+		}
+
+		newFile := filepath.Join(filepath.Dir(session.File), newName+".json")
+		if _, err := os.Stat(newFile); !errors.Is(err, os.ErrNotExist) {
+			log.Fatalf("%s already exists", newFile)
+		}
+
+		oldFile := session.File
+
+		session.Name = newName
+		session.File = newFile
+
+		// Scrollback lives in a directory named after the file
+		oldScrollback := scrollbackDir(oldFile, -1)
+		newScrollback := scrollbackDir(newFile, -1)
+
+		for i := range session.Windows {
+			for j := range session.Windows[i].Panes {
+				p := &session.Windows[i].Panes[j]
+				if rest, ok := strings.CutPrefix(p.Scrollback, oldScrollback); ok {
+					p.Scrollback = newScrollback + rest
+				}
+			}
+		}
+
+		base := filepath.Dir(oldFile)
+
+		err := os.Rename(filepath.Join(base, oldScrollback), filepath.Join(base, newScrollback))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Fatal(err)
+		}
+
+		err = writeJSON(newFile, session)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = os.Remove(oldFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if flagSessionsJSON {
+			printJSON(summarize(session))
+		}
+	},
+}
+
+var sessionDeleteCmd = &cobra.Command{
+	Use:     "delete [name...]",
+	Aliases: []string{"rm"},
+	Short:   "delete saved sessions",
+	Run: func(cmd *cobra.Command, args []string) {
+		sessions := getSessions(flagSessionsDir)
+
+		names := args
+		if len(names) == 0 {
+			name := pickSession(nil, sessions)
+			if name == "" {
+				return
+			}
+
+			names = []string{name}
+		}
+
+		// Check them all first so a typo doesn't leave half of them deleted
+		var deleted []sessionSummary
+		for _, name := range names {
+			deleted = append(deleted, summarize(mustFindSession(sessions, name)))
+		}
+
+		for _, s := range deleted {
+			err := os.Remove(s.File)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			err = os.RemoveAll(filepath.Join(filepath.Dir(s.File), scrollbackDir(s.File, -1)))
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if flagSessionsJSON {
+			printJSON(deleted)
+		}
+	},
+}
+
+func init() {
+	for _, c := range []*cobra.Command{sessionListCmd, sessionShowCmd, sessionRenameCmd, sessionDeleteCmd} {
+		c.Flags().BoolVar(&flagSessionsJSON, "json", false, "print JSON")
+		sessionCmd.AddCommand(c)
+	}
+
+	sessionShowCmd.Flags().BoolVar(&flagShowFile, "file", false, "print the file the session is saved in too")
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/distek/tmux-tools/lib"
+	"github.com/spf13/viper"
+)
+
+// The session, window and pane options saved with sessions when the config
+// doesn't list any
+var (
+	defaultSessionOptions = []string{"default-command", "status-style", "status-left", "status-right"}
+	defaultWindowOptions  = []string{"synchronize-panes", "automatic-rename", "monitor-activity"}
+	defaultPaneOptions    = []string{}
+)
+
+// sessionOptions is sessions.session_options, or the defaults
+func sessionOptions() []string {
+	if viper.IsSet("sessions.session_options") {
+		return viper.GetStringSlice("sessions.session_options")
+	}
+
+	return defaultSessionOptions
+}
+
+// windowOptions is sessions.window_options, or the defaults
+func windowOptions() []string {
+	if viper.IsSet("sessions.window_options") {
+		return viper.GetStringSlice("sessions.window_options")
+	}
+
+	return defaultWindowOptions
+}
+
+// paneOptions is sessions.pane_options, or the defaults. Pane options need
+// tmux 3.0.
+func paneOptions() []string {
+	if !lib.Supports(lib.FeaturePaneOptions) {
+		return nil
+	}
+
+	if viper.IsSet("sessions.pane_options") {
+		return viper.GetStringSlice("sessions.pane_options")
+	}
+
+	return defaultPaneOptions
+}
+
+// paneTitle is the pane's title worth saving. Panes nobody gave a title have
+// the host name, which shouldn't follow the session to other machines.
+func paneTitle(p lib.Pane) string {
+	if host, err := os.Hostname(); err == nil && p.Title == host {
+		return ""
+	}
+
+	return p.Title
+}
+
+// setOptions sets every option in opts on target
+func setOptions(target string, scope lib.OptionScope, opts map[string]string) error {
+	for name, value := range opts {
+		err := lib.SetOption(target, scope, name, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreSessionState puts back the environment and options of s in the
+// session called name. The session's first pane was started before they were
+// set, so it's started again to pick them up.
+func restoreSessionState(name string, s Session) error {
+	if len(s.Environment) == 0 && len(s.Options) == 0 {
+		return nil
+	}
+
+	err := lib.SetEnvironment(lib.SessionTarget(name), s.Environment)
+	if err != nil {
+		return err
+	}
+
+	// set-option and respawn-pane want a pane, which a bare session
+	// target isn't
+	err = setOptions(lib.ActiveTarget(name), lib.OptionSession, s.Options)
+	if err != nil {
+		return err
+	}
+
+	c := lib.Command("respawn-pane").Flag("-k").Target(lib.ActiveTarget(name))
+	if len(s.Windows) > 0 {
+		if path := firstPanePath(s.Windows[0]); path != "" {
+			c.StartDir(path)
+		}
+	}
+
+	_, e, err := c.Run()
+	if err != nil {
+		return fmt.Errorf("respawn-pane: %s: %s", err, e)
+	}
+
+	return nil
+}
+
+// restoreWindowState puts back the window's options and zoom. It goes after
+// select-layout, which would undo the zoom.
+func restoreWindowState(target string, w SessWin) error {
+	err := setOptions(target, lib.OptionWindow, w.Options)
+	if err != nil {
+		return err
+	}
+
+	if !w.Zoomed {
+		return nil
+	}
+
+	// The zoomed pane is the active one, which the panes were left on
+	_, e, err := lib.Command("resize-pane").Flag("-Z").Target(target).Run()
+	if err != nil {
+		return fmt.Errorf("resize-pane: %s: %s", err, e)
+	}
+
+	return nil
+}
@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/distek/tmux-tools/lib"
+	"github.com/spf13/viper"
+)
+
+// restoreRule is one entry of sessions.restore_rules: commands matching Match
+// are restored by running Run instead of the command itself
+type restoreRule struct {
+	Match string `mapstructure:"match"`
+	Run   string `mapstructure:"run"`
+
+	re   *regexp.Regexp
+	tmpl *template.Template
+}
+
+// restoreVars is what a rule's run template gets
+type restoreVars struct {
+	// Argv is the command's arguments as saved
+	Argv []string
+
+	// Cmd is the whole command line, quoted for the shell
+	Cmd string
+
+	// Args is Argv without the command, quoted for the shell
+	Args string
+
+	// Cwd is the pane's directory
+	Cwd string
+
+	Window int
+	Pane   int
+}
+
+// restoreConfig is the restore_cmds allow-list, restore_rules and
+// restore_deny from the sessions config
+type restoreConfig struct {
+	allow    []string
+	hasAllow bool
+	rules    []restoreRule
+	deny     []*regexp.Regexp
+}
+
+// compilePattern turns a config pattern into a regexp. Patterns are globs
+// ('*' and '?') matched against the whole command line, unless they start
+// with "re:", in which case the rest is a regexp matched anywhere in it.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if expr, ok := strings.CutPrefix(pattern, "re:"); ok {
+		return regexp.Compile(expr)
+	}
+
+	var b strings.Builder
+
+	b.WriteString("^")
+
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	b.WriteString("$")
+
+	return regexp.Compile(b.String())
+}
+
+// restoreFuncs are the functions run templates can use. exists is replaced
+// per pane in command.
+var restoreFuncs = template.FuncMap{
+	"quote":  lib.ShellQuote,
+	"join":   lib.ShellJoin,
+	"exists": func(string) bool { return false },
+}
+
+func readRestoreConfig() (*restoreConfig, error) {
+	ret := &restoreConfig{
+		allow:    viper.GetStringSlice("sessions.restore_cmds"),
+		hasAllow: viper.IsSet("sessions.restore_cmds"),
+	}
+
+	err := viper.UnmarshalKey("sessions.restore_rules", &ret.rules)
+	if err != nil {
+		return nil, fmt.Errorf("cmd: readRestoreConfig: restore_rules: %s", err)
+	}
+
+	for i := range ret.rules {
+		r := &ret.rules[i]
+
+		r.re, err = compilePattern(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("cmd: readRestoreConfig: restore_rules: %q: %s", r.Match, err)
+		}
+
+		if r.Run == "" {
+			r.Run = "{{.Cmd}}"
+		}
+
+		r.tmpl, err = template.New(r.Match).Funcs(restoreFuncs).Parse(r.Run)
+		if err != nil {
+			return nil, fmt.Errorf("cmd: readRestoreConfig: restore_rules: %q: %s", r.Match, err)
+		}
+	}
+
+	for _, pattern := range viper.GetStringSlice("sessions.restore_deny") {
+		re, err := compilePattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("cmd: readRestoreConfig: restore_deny: %q: %s", pattern, err)
+		}
+
+		ret.deny = append(ret.deny, re)
+	}
+
+	return ret, nil
+}
+
+// restoreRules is the restore config, read once
+var restoreRules = sync.OnceValues(readRestoreConfig)
+
+// matchLine is the command line patterns are matched against: the command
+// by its base name, so "nvim*" matches /usr/bin/nvim too
+func matchLine(p SessPane) string {
+	if len(p.Argv) == 0 {
+		return p.Command
+	}
+
+	argv := append([]string{filepath.Base(p.Argv[0])}, p.Argv[1:]...)
+
+	return lib.ShellJoin(argv)
+}
+
+func (c *restoreConfig) denied(line string) bool {
+	for _, re := range c.deny {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *restoreConfig) rule(line string) *restoreRule {
+	for i := range c.rules {
+		if c.rules[i].re.MatchString(line) {
+			return &c.rules[i]
+		}
+	}
+
+	return nil
+}
+
+// keep reports whether p's command should be saved at all. Denied commands
+// never are. With no restore_cmds or restore_rules, everything else is.
+func (c *restoreConfig) keep(p SessPane) bool {
+	line := matchLine(p)
+	if line == "" || c.denied(line) {
+		return false
+	}
+
+	if !c.hasAllow && len(c.rules) == 0 {
+		return true
+	}
+
+	if c.rule(line) != nil {
+		return true
+	}
+
+	for _, allowed := range c.allow {
+		if strings.HasPrefix(p.Command, allowed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// command is what gets typed into the restored pane: the matching rule's run
+// template, or the saved command as it was. Argv is re-quoted so arguments
+// with spaces or quotes come back as they were. Commands keep turns down
+// aren't restored, so changing the config applies to sessions saved before.
+func (c *restoreConfig) command(w SessWin, p SessPane) (string, error) {
+	if !c.keep(p) {
+		return "", nil
+	}
+
+	line := matchLine(p)
+
+	cmdline := p.Command
+	if len(p.Argv) > 0 {
+		cmdline = lib.ShellJoin(p.Argv)
+	}
+
+	r := c.rule(line)
+	if r == nil {
+		return cmdline, nil
+	}
+
+	vars := restoreVars{
+		Argv:   p.Argv,
+		Cmd:    cmdline,
+		Cwd:    p.Path,
+		Window: w.Index,
+		Pane:   p.Index,
+	}
+
+	if len(p.Argv) > 1 {
+		vars.Args = lib.ShellJoin(p.Argv[1:])
+	} else if len(p.Argv) == 0 {
+		// Without argv all there is to go on is the command line
+		_, vars.Args, _ = strings.Cut(p.Command, " ")
+		vars.Argv = strings.Fields(p.Command)
+	}
+
+	// exists is relative to the pane's directory, so templates can check
+	// for things like a Session.vim
+	tmpl, err := r.tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+
+	tmpl.Funcs(template.FuncMap{
+		"exists": func(name string) bool {
+			if !filepath.IsAbs(name) {
+				name = filepath.Join(p.Path, name)
+			}
+
+			_, err := os.Stat(name)
+			return err == nil
+		},
+	})
+
+	var b bytes.Buffer
+
+	err = tmpl.Execute(&b, vars)
+	if err != nil {
+		return "", fmt.Errorf("restore_rules: %q: %s", r.Match, err)
+	}
+
+	return strings.TrimSpace(b.String()), nil
+}
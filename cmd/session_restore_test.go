@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestCompilePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		line    string
+		want    bool
+	}{
+		{"nvim*", "nvim notes.md", true},
+		{"nvim*", "vim", false},
+		{"ssh ?ost", "ssh host", true},
+		// Globs match the whole line, and everything else is literal
+		{"tail", "tail -f log", false},
+		{"a.b", "axb", false},
+		{"/opt/", "/opt/", true},
+		{"/opt/", "opt", false},
+		{"/opt/*", "/opt/bin/thing", true},
+		// Regexps match anywhere
+		{`re:^tail -[fF]\b`, "tail -F log", true},
+		{`re:^tail -[fF]\b`, "tail -n 5 log", false},
+		{"re:log", "tail -f log", true},
+	}
+
+	for _, tt := range tests {
+		re, err := compilePattern(tt.pattern)
+		if err != nil {
+			t.Errorf("%s: %s", tt.pattern, err)
+			continue
+		}
+
+		if got := re.MatchString(tt.line); got != tt.want {
+			t.Errorf("%q on %q: got %t, want %t", tt.pattern, tt.line, got, tt.want)
+		}
+	}
+
+	if _, err := compilePattern("re:("); err == nil {
+		t.Error("bad regexp compiled")
+	}
+}
+
+// restoreConfigFor reads a restore config the way it comes from the config
+// file
+func restoreConfigFor(t *testing.T, settings map[string]any) *restoreConfig {
+	t.Helper()
+
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	for k, v := range settings {
+		viper.Set("sessions."+k, v)
+	}
+
+	c, err := readRestoreConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestRestoreKeep(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]any
+		argv     []string
+		want     bool
+	}{
+		{"nothing configured", nil, []string{"htop"}, true},
+		{"no command", nil, nil, false},
+		{"denied", map[string]any{"restore_deny": []string{"sudo *"}}, []string{"sudo", "rm", "x"}, false},
+		{"allowed", map[string]any{"restore_cmds": []string{"vim"}}, []string{"vim", "x"}, true},
+		{"not allowed", map[string]any{"restore_cmds": []string{"vim"}}, []string{"htop"}, false},
+		// An empty allow-list still means nothing is allowed
+		{"empty allow-list", map[string]any{"restore_cmds": []string{}}, []string{"htop"}, false},
+		{
+			name: "rule without allow-list",
+			settings: map[string]any{
+				"restore_cmds":  []string{"vim"},
+				"restore_rules": []map[string]any{{"match": "ssh *"}},
+			},
+			argv: []string{"/usr/bin/ssh", "host"},
+			want: true,
+		},
+		{
+			name: "deny beats a rule",
+			settings: map[string]any{
+				"restore_rules": []map[string]any{{"match": "ssh *"}},
+				"restore_deny":  []string{"re:prod"},
+			},
+			argv: []string{"ssh", "prod-db"},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := restoreConfigFor(t, tt.settings)
+
+			p := SessPane{Argv: tt.argv}
+			if len(tt.argv) > 0 {
+				p.Command = tt.argv[0]
+			}
+
+			if got := c.keep(p); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestoreCommand(t *testing.T) {
+	dir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(dir, "Session.vim"), nil, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := restoreConfigFor(t, map[string]any{
+		"restore_cmds": []string{"less", "htop"},
+		"restore_rules": []map[string]any{
+			{"match": "nvim*", "run": `{{if exists "Session.vim"}}nvim -S Session.vim{{else}}{{.Cmd}}{{end}}`},
+			{"match": "ssh *", "run": "ssh {{.Args}} # window {{.Window}} pane {{.Pane}}"},
+			{"match": `re:^tail -[fF]\b`},
+		},
+		"restore_deny": []string{"htop"},
+	})
+
+	w := SessWin{Index: 2}
+
+	tests := []struct {
+		name string
+		pane SessPane
+		want string
+	}{
+		{
+			name: "argv quoted again",
+			pane: SessPane{Command: "less my notes.md", Argv: []string{"less", "my notes.md"}},
+			want: "less 'my notes.md'",
+		},
+		{
+			name: "template with exists",
+			pane: SessPane{Path: dir, Command: "nvim", Argv: []string{"/usr/bin/nvim"}},
+			want: "nvim -S Session.vim",
+		},
+		{
+			name: "template without the file",
+			pane: SessPane{Path: t.TempDir(), Command: "nvim x", Argv: []string{"nvim", "x"}},
+			want: "nvim x",
+		},
+		{
+			name: "template vars",
+			pane: SessPane{Index: 1, Command: "ssh -p 22 host", Argv: []string{"ssh", "-p", "22", "host"}},
+			want: "ssh -p 22 host # window 2 pane 1",
+		},
+		{
+			// Saved without argv, only the command line to go on
+			name: "no argv",
+			pane: SessPane{Command: "tail -f /var/log/syslog"},
+			want: "tail -f /var/log/syslog",
+		},
+		{
+			name: "denied since it was saved",
+			pane: SessPane{Command: "htop", Argv: []string{"htop"}},
+		},
+		{
+			// Saved when everything was, not on the list now
+			name: "not allowed since it was saved",
+			pane: SessPane{Command: "make watch", Argv: []string{"make", "watch"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.command(w, tt.pane)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
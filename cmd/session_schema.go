@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// schemaVersion is the version of the session file format save writes. Bump
+// it, and add a migration, whenever Session, SessWin or SessPane change in a
+// way older files need help with.
+const schemaVersion = 1
+
+// migration upgrades one decoded session from the version before to the
+// next. path is the file it came from.
+type migration func(session map[string]any, path string) error
+
+// migrations[i] takes a session from version i to i+1
+var migrations = []migration{
+	// Files from before there was a version. The oldest don't say when they
+	// were saved either, so go by the file.
+	func(session map[string]any, path string) error {
+		if _, ok := session["saved"]; ok {
+			return nil
+		}
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		session["saved"] = fi.ModTime().Format(time.RFC3339Nano)
+
+		return nil
+	},
+}
+
+// fileVersion is the version in a decoded file. Files without one are 0.
+func fileVersion(raw map[string]any) (int, error) {
+	v, ok := raw["version"]
+	if !ok {
+		return 0, nil
+	}
+
+	// JSON numbers are float64, YAML ones (from templates) int
+	n, ok := v.(float64)
+	if i, isInt := v.(int); isInt {
+		n, ok = float64(i), true
+	}
+
+	if !ok || n < 0 || n != float64(int(n)) {
+		return 0, fmt.Errorf("bad version %v", v)
+	}
+
+	if int(n) > schemaVersion {
+		return 0, fmt.Errorf("version %d is newer than this tmux-tools understands (%d)", int(n), schemaVersion)
+	}
+
+	return int(n), nil
+}
+
+// migrate brings a decoded session up to schemaVersion
+func migrate(session map[string]any, path string) error {
+	v, err := fileVersion(session)
+	if err != nil {
+		return err
+	}
+
+	for ; v < schemaVersion; v++ {
+		err := migrations[v](session, path)
+		if err != nil {
+			return fmt.Errorf("upgrading from version %d: %s", v, err)
+		}
+	}
+
+	session["version"] = schemaVersion
+
+	return nil
+}
+
+// decodeMigrated decodes raw, which migrate has brought up to date, into v
+func decodeMigrated(raw map[string]any, v any) error {
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// readSession reads the session file at path, upgrading it if it's from an
+// older version
+func readSession(path string) (Session, error) {
+	f, err := os.ReadFile(path)
+	if err != nil {
+		return Session{}, fmt.Errorf("cmd: readSession: %s", err)
+	}
+
+	var raw map[string]any
+
+	err = json.Unmarshal(f, &raw)
+	if err != nil {
+		return Session{}, fmt.Errorf("cmd: readSession: %s: %s", path, err)
+	}
+
+	err = migrate(raw, path)
+	if err != nil {
+		return Session{}, fmt.Errorf("cmd: readSession: %s: %s", path, err)
+	}
+
+	var ret Session
+
+	err = decodeMigrated(raw, &ret)
+	if err != nil {
+		return Session{}, fmt.Errorf("cmd: readSession: %s: %s", path, err)
+	}
+
+	ret.File = path
+
+	return ret, nil
+}
+
+// readSnapshot reads the snapshot at path, upgrading it and its sessions if
+// they're from an older version
+func readSnapshot(path string) (ServerSnapshot, error) {
+	f, err := os.ReadFile(path)
+	if err != nil {
+		return ServerSnapshot{}, fmt.Errorf("cmd: readSnapshot: %s", err)
+	}
+
+	var raw map[string]any
+
+	err = json.Unmarshal(f, &raw)
+	if err != nil {
+		return ServerSnapshot{}, fmt.Errorf("cmd: readSnapshot: %s: %s", path, err)
+	}
+
+	_, err = fileVersion(raw)
+	if err != nil {
+		return ServerSnapshot{}, fmt.Errorf("cmd: readSnapshot: %s: %s", path, err)
+	}
+
+	sessions, _ := raw["sessions"].([]any)
+	for i, s := range sessions {
+		session, ok := s.(map[string]any)
+		if !ok {
+			return ServerSnapshot{}, fmt.Errorf("cmd: readSnapshot: %s: session %d isn't an object", path, i)
+		}
+
+		err := migrate(session, path)
+		if err != nil {
+			return ServerSnapshot{}, fmt.Errorf("cmd: readSnapshot: %s: session %d: %s", path, i, err)
+		}
+	}
+
+	raw["version"] = schemaVersion
+
+	var ret ServerSnapshot
+
+	err = decodeMigrated(raw, &ret)
+	if err != nil {
+		return ServerSnapshot{}, fmt.Errorf("cmd: readSnapshot: %s: %s", path, err)
+	}
+
+	for i := range ret.Sessions {
+		ret.Sessions[i].File = path
+	}
+
+	return ret, nil
+}
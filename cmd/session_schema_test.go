@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeOld writes body to a file last modified at mtime, standing in for a
+// file saved by an older tmux-tools
+func writeOld(t *testing.T, body string, mtime time.Time) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "old.json")
+
+	err := os.WriteFile(path, []byte(body), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chtimes(path, mtime, mtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestReadSession(t *testing.T) {
+	mtime := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+	saved := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		body  string
+		saved time.Time
+		err   string
+	}{
+		{
+			// The oldest files: no version, no saved
+			name: "version 0 without saved",
+			body: `{
+				"name": "dev",
+				"windows": [{"index": 1, "name": "code", "layout": "", "current": true,
+					"panes": [{"index": 0, "path": "/src", "command": "nvim", "current": true}]}]
+			}`,
+			saved: mtime,
+		},
+		{
+			name: "version 0 with saved",
+			body: `{
+				"name": "dev",
+				"saved": "2024-01-02T03:04:05Z",
+				"windows": [{"index": 1, "name": "code", "layout": "", "current": true,
+					"panes": [{"index": 0, "path": "/src", "command": "nvim", "current": true}]}]
+			}`,
+			saved: saved,
+		},
+		{
+			name: "current version",
+			body: `{
+				"version": 1,
+				"name": "dev",
+				"saved": "2024-01-02T03:04:05Z",
+				"windows": [{"index": 1, "name": "code", "layout": "", "current": true,
+					"panes": [{"index": 0, "path": "/src", "command": "nvim", "current": true}]}]
+			}`,
+			saved: saved,
+		},
+		{
+			name: "newer version",
+			body: `{"version": 99, "name": "dev"}`,
+			err:  "version 99 is newer",
+		},
+		{
+			name: "bad version",
+			body: `{"version": 1.5, "name": "dev"}`,
+			err:  "bad version 1.5",
+		},
+		{
+			name: "version isn't a number",
+			body: `{"version": "1", "name": "dev"}`,
+			err:  "bad version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeOld(t, tt.body, mtime)
+
+			s, err := readSession(path)
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want one with %q", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			switch {
+			case s.Version != schemaVersion:
+				t.Errorf("version: got %d, want %d", s.Version, schemaVersion)
+			case !s.Saved.Equal(tt.saved):
+				t.Errorf("saved: got %s, want %s", s.Saved, tt.saved)
+			case s.File != path:
+				t.Errorf("file: got %q, want %q", s.File, path)
+			case s.Name != "dev" || len(s.Windows) != 1 || len(s.Windows[0].Panes) != 1:
+				t.Errorf("got %+v", s)
+			case s.Windows[0].Panes[0].Command != "nvim":
+				t.Errorf("pane: %+v", s.Windows[0].Panes[0])
+			}
+		})
+	}
+}
+
+func TestReadSnapshot(t *testing.T) {
+	mtime := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		body string
+		err  string
+	}{
+		{
+			// Each session in a snapshot is migrated on its own, so one can
+			// have saved and the other not
+			name: "version 0",
+			body: `{
+				"saved": "2024-01-02T03:04:05Z",
+				"attached": "dev",
+				"order": ["dev", "mail"],
+				"sessions": [
+					{"name": "dev", "windows": [{"index": 1, "name": "code", "layout": "", "panes": [{"index": 0, "path": "/src", "command": ""}]}]},
+					{"name": "mail", "saved": "2024-01-02T03:04:05Z", "windows": [{"index": 1, "name": "mutt", "layout": "", "panes": [{"index": 0, "path": "~", "command": "mutt"}]}]}
+				]
+			}`,
+		},
+		{
+			name: "newer snapshot",
+			body: `{"version": 2, "sessions": []}`,
+			err:  "version 2 is newer",
+		},
+		{
+			name: "newer session",
+			body: `{"version": 1, "sessions": [{"version": 7, "name": "dev"}]}`,
+			err:  "session 0: version 7 is newer",
+		},
+		{
+			name: "session isn't an object",
+			body: `{"sessions": ["dev"]}`,
+			err:  "session 0 isn't an object",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeOld(t, tt.body, mtime)
+
+			snap, err := readSnapshot(path)
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want one with %q", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if snap.Version != schemaVersion || snap.Attached != "dev" || len(snap.Order) != 2 || len(snap.Sessions) != 2 {
+				t.Fatalf("got %+v", snap)
+			}
+
+			want := []time.Time{mtime, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+
+			for i, s := range snap.Sessions {
+				switch {
+				case s.Version != schemaVersion:
+					t.Errorf("%s: version: got %d", s.Name, s.Version)
+				case !s.Saved.Equal(want[i]):
+					t.Errorf("%s: saved: got %s, want %s", s.Name, s.Saved, want[i])
+				case s.File != path:
+					t.Errorf("%s: file: got %q", s.Name, s.File)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/distek/tmux-tools/lib"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const defaultScrollbackLines = 2000
+
+var (
+	flagSessionsScrollback bool
+	flagScrollbackLines    int
+)
+
+// scrollbackEnabled is --scrollback, then sessions.scrollback from the config
+func scrollbackEnabled(cmd *cobra.Command) bool {
+	if cmd.Flags().Changed("scrollback") {
+		return flagSessionsScrollback
+	}
+
+	return viper.GetBool("sessions.scrollback")
+}
+
+// scrollbackLines is --scrollback-lines, then sessions.scrollback_lines, then
+// the default
+func scrollbackLines(cmd *cobra.Command) int {
+	if cmd.Flags().Changed("scrollback-lines") {
+		return flagScrollbackLines
+	}
+
+	if viper.IsSet("sessions.scrollback_lines") {
+		return viper.GetInt("sessions.scrollback_lines")
+	}
+
+	return defaultScrollbackLines
+}
+
+// scrollbackDir is the directory, relative to the session JSON, a session's
+// scrollback goes in. Snapshots keep each session's in a numbered
+// subdirectory so session names never end up in paths.
+func scrollbackDir(jsonPath string, idx int) string {
+	dir := strings.TrimSuffix(filepath.Base(jsonPath), ".json") + ".scrollback"
+	if idx < 0 {
+		return dir
+	}
+
+	return filepath.Join(dir, strconv.Itoa(idx))
+}
+
+// saveScrollback captures up to lines of history (with colors and other
+// escapes) from every pane in session into files under rel, a directory
+// relative to base, and points the panes at them
+func saveScrollback(session *Session, base, rel string, lines int) error {
+	err := os.MkdirAll(filepath.Join(base, rel), 0750)
+	if err != nil {
+		return fmt.Errorf("cmd: saveScrollback: %s", err)
+	}
+
+	for i := range session.Windows {
+		w := &session.Windows[i]
+
+		for j := range w.Panes {
+			p := &w.Panes[j]
+
+			o, e, err := lib.Command("capture-pane").
+				Flag("-p", "-e").
+				Opt("-S", strconv.Itoa(-lines)).
+				Target(p.id).
+				Run()
+			if err != nil {
+				return fmt.Errorf("cmd: saveScrollback: %s: %s: %s", p.id, err, e)
+			}
+
+			// Everything below the last line of output is empty screen
+			o = strings.TrimRight(o, "\n")
+			if o == "" {
+				continue
+			}
+
+			file := filepath.Join(rel, fmt.Sprintf("%d.%d", w.Index, p.Index))
+
+			err = os.WriteFile(filepath.Join(base, file), []byte(o+"\n"), 0640)
+			if err != nil {
+				return fmt.Errorf("cmd: saveScrollback: %s", err)
+			}
+
+			p.Scrollback = file
+		}
+	}
+
+	return nil
+}
+
+// paneStart is what tmux runs in new panes of a session
+type paneStart struct {
+	Shell   string `tmux:"default-shell"`
+	Command string `tmux:"default-command"`
+}
+
+// startCommand is the shell command that starts what a new pane at target
+// would: default-command (through default-shell, like tmux does) if it's
+// set, otherwise default-shell itself
+func startCommand(target string) string {
+	start, err := lib.QueryOne[paneStart](target)
+	if err != nil || start.Shell == "" {
+		start.Shell = os.Getenv("SHELL")
+		if start.Shell == "" {
+			start.Shell = "/bin/sh"
+		}
+	}
+
+	if start.Command != "" {
+		return fmt.Sprintf("exec %s -c %s", lib.ShellQuote(start.Shell), lib.ShellQuote(start.Command))
+	}
+
+	return "exec " + lib.ShellQuote(start.Shell)
+}
+
+// replayScrollback restarts the pane at target so it prints the saved
+// scrollback in file before starting what the pane normally would, as if it
+// had been there all along. file has to be absolute since the pane starts in
+// dir.
+func replayScrollback(target, dir, file string) error {
+	c := lib.Command("respawn-pane").Flag("-k").Target(target)
+	if dir != "" {
+		c.StartDir(dir)
+	}
+
+	_, e, err := c.Arg(fmt.Sprintf("cat %s; %s", lib.ShellQuote(file), startCommand(target))).Run()
+	if err != nil {
+		return fmt.Errorf("respawn-pane: %s: %s", err, e)
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/distek/tmux-tools/lib"
+	"github.com/spf13/cobra"
+)
+
+// snapshotsDir is where save --all puts its snapshots, under flagSessionsDir
+const snapshotsDir = "snapshots"
+
+// ServerSnapshot is every session on a server, saved with `sessions save --all`
+type ServerSnapshot struct {
+	Version int       `json:"version"`
+	Saved   time.Time `json:"saved"`
+
+	// Attached is the session the client was on
+	Attached string `json:"attached"`
+
+	// Order is the sessions from most to least recently attached, which is
+	// the order switch-client -l walks back through
+	Order []string `json:"order"`
+
+	Sessions []Session `json:"sessions"`
+}
+
+// snapshotPath is the file for the snapshot called name
+func snapshotPath(name string) string {
+	if name == "" {
+		name = "all"
+	}
+
+	return filepath.Join(flagSessionsDir, snapshotsDir, name+".json")
+}
+
+// captureServer snapshots every session on the server. With fromClient, the
+// session we're run from counts as the attached one.
+func captureServer(fromClient bool) (ServerSnapshot, error) {
+	sessions, err := lib.ListSessions()
+	if err != nil {
+		return ServerSnapshot{}, fmt.Errorf("cmd: captureServer: %s", err)
+	}
+
+	ret := ServerSnapshot{Version: schemaVersion, Saved: time.Now()}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].LastAttached > sessions[j].LastAttached
+	})
+
+	for _, s := range sessions {
+		session, err := captureSession(s.ID, s.Name)
+		if err != nil {
+			return ServerSnapshot{}, fmt.Errorf("cmd: captureServer: %s: %s", s.Name, err)
+		}
+
+		ret.Sessions = append(ret.Sessions, session)
+		ret.Order = append(ret.Order, s.Name)
+	}
+
+	// Control mode clients (autosave's own, for one) don't count as
+	// attached
+	if clients, err := lib.ListClients(); err == nil {
+		var latest int64 = -1
+
+		for _, c := range clients {
+			if !c.ControlMode && c.Activity > latest {
+				latest = c.Activity
+				ret.Attached = c.Session
+			}
+		}
+	}
+
+	// From inside tmux, the session we're run from wins over whichever
+	// other client was used last
+	if fromClient && os.Getenv("TMUX") != "" {
+		if current, err := lib.GetSession(""); err == nil {
+			ret.Attached = current.Name
+		}
+	}
+
+	if ret.Attached == "" && len(ret.Order) > 0 {
+		ret.Attached = ret.Order[0]
+	}
+
+	return ret, nil
+}
+
+func saveAll(cmd *cobra.Command) {
+	snap, err := captureServer(true)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	path := snapshotPath(flagSessionName)
+	base := filepath.Dir(path)
+
+	err = os.RemoveAll(filepath.Join(base, scrollbackDir(path, -1)))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if scrollbackEnabled(cmd) {
+		for i := range snap.Sessions {
+			err := saveScrollback(&snap.Sessions[i], base, scrollbackDir(path, i), scrollbackLines(cmd))
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	err = writeJSON(path, snap)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// restoreServer restores every session in snap that isn't running already,
+// then puts the client back on the attached session with the same
+// last-session history. If any session fails it exits before attaching, so
+// the errors aren't hidden behind the client.
+func restoreServer(snap ServerSnapshot) {
+	var failed []string
+
+	for _, s := range snap.Sessions {
+		if lib.HasSession(s.Name) {
+			log.Printf("session %s already exists, skipping", s.Name)
+			continue
+		}
+
+		err := restoreSession(s)
+		if err != nil {
+			log.Println(err)
+			failed = append(failed, s.Name)
+		}
+	}
+
+	if len(failed) > 0 {
+		log.Fatalf("couldn't restore %s", strings.Join(failed, ", "))
+	}
+
+	if snap.Attached != "" && lib.HasSession(snap.Attached) {
+		if os.Getenv("TMUX") != "" {
+			// Visit the sessions least recent first so switch-client -l
+			// goes back through them in the saved order
+			order := slices.Clone(snap.Order)
+			slices.Reverse(order)
+
+			for _, name := range order {
+				if name == snap.Attached || !lib.HasSession(name) {
+					continue
+				}
+
+				_, e, err := lib.Command("switch-client").Target(lib.SessionTarget(name)).Run()
+				if err != nil {
+					log.Println(e)
+					log.Println(err)
+				}
+			}
+		}
+
+		attachSession(snap.Attached)
+	}
+}
+
+func loadAll() {
+	snap, err := readSnapshot(snapshotPath(flagSessionName))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	restoreServer(snap)
+}
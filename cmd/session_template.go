@@ -0,0 +1,429 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/distek/tmux-tools/lib"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// The file extensions templates can have
+var templateExts = []string{".json", ".yaml", ".yml"}
+
+var (
+	flagTemplateName string
+	flagTemplateVars []string
+)
+
+// templatesDir is sessions.templates_path, or a templates directory next to
+// the sessions directory
+func templatesDir() string {
+	if dir := viper.GetString("sessions.templates_path"); dir != "" {
+		return expandPath(dir, "")
+	}
+
+	return filepath.Join(filepath.Dir(flagSessionsDir), "templates")
+}
+
+// listTemplates returns the names of the templates in templatesDir
+func listTemplates() ([]string, error) {
+	entries, err := os.ReadDir(templatesDir())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("cmd: listTemplates: %s", err)
+	}
+
+	var ret []string
+
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || !slices.Contains(templateExts, ext) {
+			continue
+		}
+
+		ret = append(ret, strings.TrimSuffix(e.Name(), ext))
+	}
+
+	return ret, nil
+}
+
+// templatePath finds the file for the template called name
+func templatePath(name string) (string, error) {
+	for _, ext := range templateExts {
+		path := filepath.Join(templatesDir(), name+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("no template named %s in %s", name, templatesDir())
+}
+
+// templateVars reads --var NAME=value flags. Root defaults to the current
+// directory and Name to Root's base name.
+func templateVars(vars []string) (map[string]string, error) {
+	ret := make(map[string]string)
+
+	for _, v := range vars {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("--var %q should be NAME=value", v)
+		}
+
+		ret[name] = value
+	}
+
+	if ret["Root"] == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+
+		ret["Root"] = wd
+	}
+
+	ret["Root"] = expandPath(ret["Root"], "")
+
+	if flagSessionName != "" {
+		ret["Name"] = flagSessionName
+	}
+
+	if ret["Name"] == "" {
+		ret["Name"] = filepath.Base(ret["Root"])
+	}
+
+	return ret, nil
+}
+
+// Template actions are swapped for slot words while a template is decoded
+var (
+	templateAction = regexp.MustCompile(`\{\{.*?\}\}`)
+	templateSlot   = regexp.MustCompile(`tmuxToolsSlot(\d+)x`)
+)
+
+// fillValues puts the template actions back into every string in v, a
+// decoded template, and fills them in with vars. Filling in after decoding
+// means values never have to be escaped for YAML or JSON.
+func fillValues(v any, name string, actions []string, vars map[string]string) (any, error) {
+	switch v := v.(type) {
+	case string:
+		if !templateSlot.MatchString(v) {
+			return v, nil
+		}
+
+		text := templateSlot.ReplaceAllStringFunc(v, func(slot string) string {
+			i, _ := strconv.Atoi(templateSlot.FindStringSubmatch(slot)[1])
+			return actions[i]
+		})
+
+		tmpl, err := template.New(name).
+			Option("missingkey=error").
+			Funcs(template.FuncMap{"env": os.Getenv}).
+			Parse(text)
+		if err != nil {
+			return nil, err
+		}
+
+		var b strings.Builder
+
+		err = tmpl.Execute(&b, vars)
+		if err != nil {
+			return nil, err
+		}
+
+		return b.String(), nil
+	case []any:
+		for i := range v {
+			item, err := fillValues(v[i], name, actions, vars)
+			if err != nil {
+				return nil, err
+			}
+
+			v[i] = item
+		}
+
+		return v, nil
+	case map[string]any:
+		ret := make(map[string]any, len(v))
+
+		for k, item := range v {
+			key, err := fillValues(k, name, actions, vars)
+			if err != nil {
+				return nil, err
+			}
+
+			item, err = fillValues(item, name, actions, vars)
+			if err != nil {
+				return nil, err
+			}
+
+			ret[key.(string)] = item
+		}
+
+		return ret, nil
+	}
+
+	return v, nil
+}
+
+// jsonField finds the field of struct type t that the JSON key decodes into
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		if strings.EqualFold(name, key) {
+			return f, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// coerceValues converts the scalars in v, a filled in template, to the type
+// of the field of t they decode into. Placeholders always fill in as strings,
+// so this is what lets "index": {{.Idx}} work, and it lets option values be
+// written as plain YAML numbers.
+func coerceValues(v any, t reflect.Type) (any, error) {
+	switch v := v.(type) {
+	case string:
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%q isn't a number", v)
+			}
+
+			return n, nil
+		case reflect.Bool:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("%q isn't true or false", v)
+			}
+
+			return b, nil
+		}
+	case int, int64, uint64, float64, bool:
+		if t.Kind() == reflect.String {
+			return fmt.Sprint(v), nil
+		}
+	case []any:
+		if t.Kind() != reflect.Slice {
+			return v, nil
+		}
+
+		for i := range v {
+			item, err := coerceValues(v[i], t.Elem())
+			if err != nil {
+				return nil, fmt.Errorf("%d: %s", i, err)
+			}
+
+			v[i] = item
+		}
+	case map[string]any:
+		for k, item := range v {
+			var want reflect.Type
+
+			switch t.Kind() {
+			case reflect.Map:
+				want = t.Elem()
+			case reflect.Struct:
+				f, ok := jsonField(t, k)
+				if !ok {
+					continue
+				}
+
+				want = f.Type
+			default:
+				return v, nil
+			}
+
+			item, err := coerceValues(item, want)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", k, err)
+			}
+
+			v[k] = item
+		}
+	}
+
+	return v, nil
+}
+
+// renderTemplate fills in the template at path and reads the result as a
+// session
+func renderTemplate(path string, vars map[string]string) (Session, error) {
+	f, err := os.ReadFile(path)
+	if err != nil {
+		return Session{}, fmt.Errorf("cmd: renderTemplate: %s", err)
+	}
+
+	// Actions become plain words while decoding, so they can go anywhere a
+	// value can, quoted or not
+	var actions []string
+
+	masked := templateAction.ReplaceAllStringFunc(string(f), func(action string) string {
+		actions = append(actions, action)
+		return fmt.Sprintf("tmuxToolsSlot%dx", len(actions)-1)
+	})
+
+	// JSON is YAML too
+	var raw map[string]any
+
+	err = yaml.Unmarshal([]byte(masked), &raw)
+	if err != nil {
+		return Session{}, fmt.Errorf("cmd: renderTemplate: %s: %s", path, err)
+	}
+
+	filled, err := fillValues(raw, filepath.Base(path), actions, vars)
+	if err != nil {
+		return Session{}, fmt.Errorf("cmd: renderTemplate: %s", err)
+	}
+
+	raw = filled.(map[string]any)
+
+	err = migrate(raw, path)
+	if err != nil {
+		return Session{}, fmt.Errorf("cmd: renderTemplate: %s: %s", path, err)
+	}
+
+	_, err = coerceValues(raw, reflect.TypeFor[Session]())
+	if err != nil {
+		return Session{}, fmt.Errorf("cmd: renderTemplate: %s: %s", path, err)
+	}
+
+	var ret Session
+
+	err = decodeMigrated(raw, &ret)
+	if err != nil {
+		return Session{}, fmt.Errorf("cmd: renderTemplate: %s: %s", path, err)
+	}
+
+	if ret.Name == "" {
+		ret.Name = vars["Name"]
+	}
+
+	ret.File = path
+
+	numberWindows(&ret)
+	focusFirst(&ret)
+
+	return ret, nil
+}
+
+// duplicateIndex reports whether any two of items have the same index, which
+// is what leaving indexes out of a template looks like
+func duplicateIndex[T any](items []T, index func(T) int) bool {
+	seen := make(map[int]bool, len(items))
+
+	for _, item := range items {
+		if seen[index(item)] {
+			return true
+		}
+
+		seen[index(item)] = true
+	}
+
+	return false
+}
+
+// numberWindows gives windows and panes indexes when the template leaves
+// them out (or repeats them). Indexes it gives are left alone.
+func numberWindows(s *Session) {
+	winBase, paneBase := importIndexes()
+
+	renumberWindows := duplicateIndex(s.Windows, func(w SessWin) int { return w.Index })
+
+	for i := range s.Windows {
+		w := &s.Windows[i]
+
+		if renumberWindows {
+			w.Index = winBase + i
+		}
+
+		if duplicateIndex(w.Panes, func(p SessPane) int { return p.Index }) {
+			for j := range w.Panes {
+				w.Panes[j].Index = paneBase + j
+			}
+		}
+	}
+}
+
+var sessionNewCmd = &cobra.Command{
+	Use:   "new",
+	Short: "start a session from a template",
+	Long: `Templates are session files, JSON or YAML, in the templates directory
+next to the sessions directory (or sessions.templates_path). They're Go
+templates: {{.Root}}, {{.Name}} and any other --var NAME=value fill in, and
+{{env "X"}} is the environment variable X.
+
+Root defaults to the current directory and Name to Root's base name.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		initGlobalArgs()
+
+		name := flagTemplateName
+		if name == "" {
+			templates, err := listTemplates()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			name, err = lib.Fzf(templates)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if name == "" {
+				return
+			}
+		}
+
+		path, err := templatePath(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		vars, err := templateVars(flagTemplateVars)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		session, err := renderTemplate(path, vars)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		loadSession(session)
+	},
+}
+
+func init() {
+	sessionCmd.AddCommand(sessionNewCmd)
+	sessionNewCmd.Flags().StringVarP(&flagTemplateName, "template", "t", "", "template to start the session from")
+	sessionNewCmd.Flags().StringArrayVar(&flagTemplateVars, "var", nil, "template variable as NAME=value, can be repeated")
+	sessionNewCmd.Flags().BoolVarP(&flagSessionAttach, "attach", "a", false, "attach to the session if it's already running instead of failing")
+}
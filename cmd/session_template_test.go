@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTemplate writes body to a template file called name
+func writeTemplate(t *testing.T, name, body string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+
+	err := os.WriteFile(path, []byte(body), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestRenderTemplate(t *testing.T) {
+	fakeServer(t)
+
+	vars := map[string]string{
+		"Root": "/src/api",
+		"Name": "api",
+		"Win":  "3",
+		// Things that would break the file if they went in before decoding
+		"Cmd": `echo "a: b # c" {x}`,
+	}
+
+	tests := []struct {
+		name string
+		file string
+		body string
+	}{
+		{
+			name: "yaml",
+			file: "api.yaml",
+			body: `
+version: 1
+name: {{.Name}}-dev
+windows:
+  - index: {{.Win}}
+    name: '{{.Name}}'
+    panes:
+      - path: {{.Root}}/cmd
+        command: {{.Cmd}}
+      - path: "{{.Root}}"
+        command: '{{if eq .Name "api"}}go run .{{else}}sh{{end}}'
+options:
+  history-limit: 5000
+`,
+		},
+		{
+			// Actions are left alone while decoding, so the quotes in
+			// them don't need escaping
+			name: "json",
+			file: "api.json",
+			body: `{
+	"name": "{{.Name}}-dev",
+	"windows": [{
+		"index": {{.Win}},
+		"name": "{{.Name}}",
+		"panes": [
+			{"path": "{{.Root}}/cmd", "command": "{{.Cmd}}"},
+			{"path": "{{.Root}}", "command": "{{if eq .Name "api"}}go run .{{else}}sh{{end}}"}
+		]
+	}],
+	"options": {"history-limit": 5000}
+}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := renderTemplate(writeTemplate(t, tt.file, tt.body), vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if s.Name != "api-dev" || len(s.Windows) != 1 || s.Options["history-limit"] != "5000" {
+				t.Fatalf("got %+v", s)
+			}
+
+			w := s.Windows[0]
+
+			switch {
+			case w.Index != 3 || w.Name != "api" || len(w.Panes) != 2:
+				t.Errorf("window: %+v", w)
+			case w.Panes[0].Path != "/src/api/cmd" || w.Panes[0].Command != vars["Cmd"]:
+				t.Errorf("first pane: %+v", w.Panes[0])
+			case w.Panes[1].Path != "/src/api" || w.Panes[1].Command != "go run .":
+				t.Errorf("second pane: %+v", w.Panes[1])
+			case !w.Current || !w.Panes[0].Current:
+				t.Errorf("nothing focused: %+v", w)
+			}
+		})
+	}
+}
+
+func TestRenderTemplateErrors(t *testing.T) {
+	fakeServer(t)
+
+	vars := map[string]string{"Root": "/src/api", "Name": "api"}
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "missing var",
+			body: "windows:\n  - panes:\n      - command: go run . -port {{.Port}}\n",
+			want: "Port",
+		},
+		{
+			name: "not a number",
+			body: "windows:\n  - index: {{.Name}}\n",
+			want: `"api" isn't a number`,
+		},
+		{
+			name: "action across values",
+			body: "windows:\n  - name: '{{if .Name}}a'\n    layout: 'b{{end}}'\n",
+			want: "unexpected EOF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := renderTemplate(writeTemplate(t, "x.yaml", tt.body), vars)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want one about %s", err, tt.want)
+			}
+		})
+	}
+}
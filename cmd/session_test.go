@@ -0,0 +1,327 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/distek/tmux-tools/lib/layout"
+	"github.com/distek/tmux-tools/lib/tmuxtest"
+)
+
+// withChecksum turns a layout body into a full window_layout string
+func withChecksum(body string) string {
+	return fmt.Sprintf("%04x,%s", layout.Checksum(body), body)
+}
+
+func TestRestoreSession(t *testing.T) {
+	srv := fakeServer(t)
+
+	// Windows come back at their saved indexes whatever base-index is, and
+	// panes are found however pane-base-index numbers them
+	tmux(t, "set-option", "-g", "base-index", "1")
+	tmux(t, "set-option", "-gw", "pane-base-index", "1")
+
+	session := Session{
+		Name: "dev",
+		Windows: []SessWin{
+			{
+				Index:  0,
+				Name:   "editor",
+				Layout: withChecksum("80x24,0,0{30x24,0,0,0,49x24,31,0,1}"),
+				Panes: []SessPane{
+					{Index: 0, Path: "/src/dev"},
+					{Index: 1, Path: "/src/dev/api", Current: true},
+				},
+			},
+			{
+				Index:   3,
+				Name:    "shell",
+				Current: true,
+				Layout:  withChecksum("80x24,0,0,2"),
+				Panes: []SessPane{
+					{Index: 0, Path: "/tmp", Current: true},
+				},
+			},
+		},
+	}
+
+	err := restoreSession(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(srv.Sessions()); n != 1 {
+		t.Fatalf("got %d sessions, want just dev", n)
+	}
+
+	got := tmux(t, "list-windows", "-t", "=dev", "-F", "#{window_index} #{window_name} #{window_panes}")
+	if want := "0 editor 2\n3 shell 1"; got != want {
+		t.Errorf("windows: got %q, want %q", got, want)
+	}
+
+	got = tmux(t, "list-panes", "-s", "-t", "=dev", "-F", "#{pane_current_path} #{pane_width}")
+	if want := "/src/dev 30\n/src/dev/api 49\n/tmp 80"; got != want {
+		t.Errorf("panes: got %q, want %q", got, want)
+	}
+
+	got = tmux(t, "display-message", "-p", "-t", "=dev:0", "#{pane_index}")
+	if got != "2" {
+		t.Errorf("active pane in window 0: got %s, want the second one, 2", got)
+	}
+
+	got = tmux(t, "display-message", "-p", "-t", "=dev:", "#{window_index}")
+	if got != "3" {
+		t.Errorf("current window: got %s, want 3", got)
+	}
+}
+
+func TestRestoreSessionRollback(t *testing.T) {
+	srv := fakeServer(t)
+
+	// The second window can't have the index the first one took
+	session := Session{
+		Name: "dev",
+		Windows: []SessWin{
+			{Index: 0, Layout: withChecksum("80x24,0,0,0"), Panes: []SessPane{{Path: "/src/dev"}}},
+			{Index: 0, Layout: withChecksum("80x24,0,0,1"), Panes: []SessPane{{Path: "/tmp"}}},
+		},
+	}
+
+	err := restoreSession(session)
+	if err == nil {
+		t.Fatal("restoring two windows at index 0 worked")
+	}
+
+	if n := len(srv.Sessions()); n != 0 {
+		t.Errorf("got %d sessions left after a failed restore, want none", n)
+	}
+}
+
+// comparable clears what's expected to differ between two captures of the
+// same session: when they were taken, where they were read from, pane IDs,
+// and the pane IDs in layouts
+func comparable(t *testing.T, s Session) Session {
+	t.Helper()
+
+	s.Saved = time.Time{}
+	s.File = ""
+
+	windows := make([]SessWin, len(s.Windows))
+
+	for i, w := range s.Windows {
+		l, err := layout.Parse(w.Layout)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for j, p := range l.Panes() {
+			p.PaneID = j
+		}
+
+		w.Layout = l.String()
+
+		panes := make([]SessPane, len(w.Panes))
+		for j, p := range w.Panes {
+			p.id = ""
+			panes[j] = p
+		}
+
+		w.Panes = panes
+		windows[i] = w
+	}
+
+	s.Windows = windows
+
+	return s
+}
+
+// saveLoad saves the session called name the way sessions save does, kills
+// it and loads it back. It returns the session as saved and as captured
+// again after loading.
+func saveLoad(t *testing.T, srv *tmuxtest.Server, name string) (Session, Session) {
+	t.Helper()
+
+	target := func() string {
+		return fmt.Sprintf("$%d", srv.Session(name).ID)
+	}
+
+	saved, err := captureSession(target(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+
+	err = writeJSON(filepath.Join(dir, name+".json"), saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := getSessions(dir)
+	if len(sessions) != 1 {
+		t.Fatalf("read back %d sessions, want 1", len(sessions))
+	}
+
+	tmux(t, "kill-session", "-t", "="+name)
+
+	err = restoreSession(sessions[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(srv.Sessions()); n != 1 {
+		t.Fatalf("got %d sessions, want just %s", n, name)
+	}
+
+	restored, err := captureSession(target(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return saved, restored
+}
+
+func TestSaveLoad(t *testing.T) {
+	srv := fakeServer(t)
+
+	tmux(t, "new-session", "-d", "-s", "dev", "-c", "/src/dev")
+	tmux(t, "set-environment", "-t", "=dev", "API_URL", "http://localhost:8080")
+	tmux(t, "set-option", "-t", "=dev:", "status-left", "[dev] ")
+	tmux(t, "rename-window", "-t", "=dev:0", "editor")
+	tmux(t, "split-window", "-h", "-t", "=dev:0", "-c", "/src/dev/api")
+	tmux(t, "split-window", "-v", "-t", "=dev:0.1", "-c", "/src/dev/web")
+	tmux(t, "select-pane", "-t", "=dev:0.1", "-T", "logs")
+	tmux(t, "resize-pane", "-Z", "-t", "=dev:0.2")
+	tmux(t, "new-window", "-t", "=dev:3", "-n", "shell", "-c", "/tmp")
+	tmux(t, "set-option", "-w", "-t", "=dev:3", "monitor-activity", "on")
+	tmux(t, "select-window", "-t", "=dev:0")
+
+	saved, restored := saveLoad(t, srv, "dev")
+
+	got, want := comparable(t, restored), comparable(t, saved)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("restored session differs\ngot:  %+v\nwant: %+v", got, want)
+	}
+
+	// Spot check what the comparison above relies on having been saved
+	w := saved.Windows[0]
+	switch {
+	case saved.Environment["API_URL"] != "http://localhost:8080":
+		t.Errorf("environment not saved: %v", saved.Environment)
+	case saved.Options["status-left"] != "[dev] ":
+		t.Errorf("session options not saved: %v", saved.Options)
+	case w.Name != "editor" || !w.Current || !w.Zoomed || len(w.Panes) != 3:
+		t.Errorf("window not saved: %+v", w)
+	case w.Panes[1].Title != "logs" || w.Panes[2].Path != "/src/dev/web" || !w.Panes[2].Current:
+		t.Errorf("panes not saved: %+v", w.Panes)
+	case saved.Windows[1].Index != 3 || saved.Windows[1].Options["monitor-activity"] != "on":
+		t.Errorf("second window not saved: %+v", saved.Windows[1])
+	}
+}
+
+func TestSaveLoadScrollback(t *testing.T) {
+	srv := fakeServer(t)
+
+	tmux(t, "new-session", "-d", "-s", "logs", "-c", "/var/log")
+	tmux(t, "set-option", "-t", "=logs:", "default-command", "fish")
+	tmux(t, "split-window", "-t", "=logs:0", "-c", "/tmp")
+
+	srv.Pane("%0").Output = []string{"$ make", "ok", ""}
+
+	saved, err := captureSession(fmt.Sprintf("$%d", srv.Session("logs").ID), "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "logs.json")
+
+	err = saveScrollback(&saved, dir, scrollbackDir(path, -1), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeJSON(path, saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Scrollback is found next to the session file, not in the working
+	// directory
+	t.Chdir(t.TempDir())
+
+	loaded, err := readSession(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmux(t, "kill-session", "-t", "=logs")
+
+	err = restoreSession(loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	panes := srv.Session("logs").Windows[0].Panes()
+
+	file := filepath.Join(dir, "logs.scrollback", "0.0")
+	want := fmt.Sprintf("cat '%s'; exec '/bin/sh' -c 'fish'", file)
+	if panes[0].Start != want {
+		t.Errorf("first pane started with %q, want %q", panes[0].Start, want)
+	}
+
+	// Nothing on screen, nothing saved or replayed
+	if saved.Windows[0].Panes[1].Scrollback != "" || panes[1].Start != "" {
+		t.Errorf("empty pane got scrollback: %q, started with %q", saved.Windows[0].Panes[1].Scrollback, panes[1].Start)
+	}
+}
+
+func TestRestoreSessionSendsLiterally(t *testing.T) {
+	srv := fakeServer(t)
+
+	session := Session{
+		Name: "dev",
+		Windows: []SessWin{
+			{
+				Index:  0,
+				Layout: withChecksum("80x24,0,0,0"),
+				Panes: []SessPane{
+					// A command that's also a key name
+					{Index: 0, Path: "/src/dev", Before: []string{"Home"}, Command: "make test"},
+				},
+			},
+		},
+	}
+
+	err := restoreSession(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The pane is in the session under its temporary name
+	target := regexp.MustCompile(` '-t' '[^']*'`)
+
+	var sent []string
+	for _, c := range srv.Log() {
+		if strings.HasPrefix(c, "send-keys ") {
+			sent = append(sent, target.ReplaceAllString(c, ""))
+		}
+	}
+
+	want := []string{
+		"send-keys '-l' '--' 'Home'",
+		"send-keys 'Enter'",
+		"send-keys '-l' '--' 'make test'",
+		"send-keys 'Enter'",
+	}
+
+	if !slices.Equal(sent, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(sent, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/distek/tmux-tools/lib"
+	"github.com/distek/tmux-tools/lib/layout"
 	"github.com/spf13/cobra"
 )
 
@@ -21,52 +22,57 @@ var wmCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		initGlobalArgs()
+
+		disconnect := useControlClient()
+
+		err := lib.Require(lib.FeaturePaneAt)
+		if err != nil {
+			disconnect()
+			log.Fatal(err)
+		}
+
+		defer disconnect()
+
 		dir := args[0]
 
 		moveWindowInDir(dir)
 	},
 }
 
-func mergeMaps(dst, src map[string]string) map[string]string {
-	for k, v := range src {
-		dst[k] = v
+// splitFlags returns the split-window/join-pane flags that place the new pane
+// on the dir side of the target
+func splitFlags(dir string) []string {
+	switch dir {
+	case "top":
+		return []string{"-b", "-v"}
+	case "bottom":
+		return []string{"-v"}
+	case "left":
+		return []string{"-b", "-h"}
+	case "right":
+		return []string{"-h"}
 	}
 
-	return dst
+	return nil
 }
 
-func splitFull(pane lib.Pane, dir string) {
-	targetPane, err := lib.GetFurthestPaneInDir(dir)
+func splitFull(snap *lib.Snapshot, pane lib.Pane, dir string) {
+	targetPane, err := snap.FurthestPaneInDir(dir)
 	if err != nil {
 		log.Println(err)
-		targetPane, err = lib.GetFurthestPaneInDir("top-" + dir)
+		targetPane, err = snap.FurthestPaneInDir("top-" + dir)
 		if err != nil {
 			log.Fatal(err)
 		}
 	}
 
-	defaultArgs := map[string]string{
-		"-f": "",
-		"-t": targetPane.ID,
-	}
-	extraArgs := make(map[string]string, 2)
-
-	switch dir {
-	case "top":
-		extraArgs["-b"] = ""
-		extraArgs["-v"] = ""
-	case "bottom":
-		extraArgs["-v"] = ""
-	case "left":
-		extraArgs["-b"] = ""
-		extraArgs["-h"] = ""
-	case "right":
-		extraArgs["-h"] = ""
-	}
-
-	merged := mergeMaps(defaultArgs, extraArgs)
-
-	_, e, err := lib.Tmux(lib.GlobalArgs, "split-window", merged, "cat")
+	_, e, err := lib.Command("split-window").
+		Flag("-f").
+		Target(targetPane.ID).
+		Flag(splitFlags(dir)...).
+		Arg("cat").
+		Run()
 	if err != nil {
 		log.Println(e)
 		log.Fatal(err)
@@ -93,39 +99,51 @@ func splitFull(pane lib.Pane, dir string) {
 }
 
 func splitHalf(dst, src lib.Pane, dir string) {
-	defaultArgs := map[string]string{
-		"-t": dst.ID,
-		"-s": src.ID,
+	o, e, err := lib.Command("join-pane").
+		Target(dst.ID).
+		Source(src.ID).
+		Flag(splitFlags(dir)...).
+		Run()
+	if err != nil {
+		log.Fatal(fmt.Errorf("cmd: moveWindowInDir: lib.Command: %s: command failed: err=%s, stdout=%s, err=%s", dir, err, o, e))
 	}
+}
 
-	extraArgs := make(map[string]string, 2)
-	switch dir {
-	case "top":
-		extraArgs["-b"] = ""
-		extraArgs["-v"] = ""
-	case "bottom":
-		extraArgs["-v"] = ""
-	case "left":
-		extraArgs["-b"] = ""
-		extraArgs["-h"] = ""
-	case "right":
-		extraArgs["-h"] = ""
+// spansEdge reports whether pane already fills the whole dir side of the
+// window, that is, it's the first or last child of a top level split along
+// dir's axis. There's nothing further for it to move then.
+func spansEdge(root *layout.Cell, pane lib.Pane, dir string) bool {
+	axis := layout.TopBottom
+	if dir == "left" || dir == "right" {
+		axis = layout.LeftRight
 	}
 
-	merged := mergeMaps(defaultArgs, extraArgs)
+	if root.Type != axis {
+		return false
+	}
 
-	o, e, err := lib.Tmux(lib.GlobalArgs, "join-pane", merged, "")
-	if err != nil {
-		log.Fatal(fmt.Errorf("cmd: moveWindowInDir: lib.Tmux: %s: command failed: err=%s, stdout=%s, err=%s", dir, err, o, e))
+	edge := root.Children[0]
+	if dir == "bottom" || dir == "right" {
+		edge = root.Children[len(root.Children)-1]
 	}
+
+	return edge.Type == layout.Pane && fmt.Sprintf("%%%d", edge.PaneID) == pane.ID
 }
 
 func moveWindowInDir(dir string) {
-	panesLen := lib.GetPanesLen()
+	snap, err := lib.NewSnapshot("")
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// If there's only one pane, or it errored, return with int
-	if panesLen <= 0 {
-		os.Exit(panesLen)
+	panesLen, err := snap.Len()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Nothing to move with only one pane
+	if panesLen <= 1 {
+		return
 	}
 
 	currPane, err := lib.GetCurrentPane("")
@@ -133,56 +151,49 @@ func moveWindowInDir(dir string) {
 		log.Fatalf("GetCurrentPane: %s", err)
 	}
 
-	neighbors, err := lib.GetNeighbors(currPane)
+	neighbors, err := snap.Neighbors(currPane)
 	if err != nil {
 		log.Fatalf("GetNeighbors: %s", err)
 	}
 
+	root, err := snap.Layout()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// favor splitting to the right or bottom when merging panes
 	switch dir {
 	case "top":
 		if neighbors.Panes["top"].Exists {
 			splitHalf(neighbors.Panes["top"].Pane, currPane, "right")
-		} else {
-			if panesLen == 2 || neighbors.Panes["left"].Exists || neighbors.Panes["right"].Exists {
-				splitFull(currPane, "top")
-			}
+		} else if !spansEdge(root, currPane, "top") {
+			splitFull(snap, currPane, "top")
 		}
 	case "bottom":
 		if neighbors.Panes["bottom"].Exists {
 			splitHalf(neighbors.Panes["bottom"].Pane, currPane, "right")
-		} else {
-			if panesLen == 2 || neighbors.Panes["left"].Exists || neighbors.Panes["right"].Exists {
-				splitFull(currPane, "bottom")
-			}
+		} else if !spansEdge(root, currPane, "bottom") {
+			splitFull(snap, currPane, "bottom")
 		}
 	case "left":
 		if neighbors.Panes["left"].Exists {
 			splitHalf(neighbors.Panes["left"].Pane, currPane, "bottom")
-		} else {
-			if panesLen == 2 || neighbors.Panes["top"].Exists || neighbors.Panes["bottom"].Exists {
-				splitFull(currPane, "left")
-			}
+		} else if !spansEdge(root, currPane, "left") {
+			splitFull(snap, currPane, "left")
 		}
 	case "right":
 		if neighbors.Panes["right"].Exists {
 			splitHalf(neighbors.Panes["right"].Pane, currPane, "bottom")
-		} else {
-			if panesLen == 2 || neighbors.Panes["top"].Exists || neighbors.Panes["bottom"].Exists {
-				splitFull(currPane, "right")
-			}
+		} else if !spansEdge(root, currPane, "right") {
+			splitFull(snap, currPane, "right")
 		}
 	}
 
 	_ = lib.SelectPane(currPane)
-
-	lib.UsePaneCache = false
 }
 
 func init() {
 	rootCmd.AddCommand(wmCmd)
 
 	initGlobalArgs()
-
-	lib.UsePaneCache = false
 }
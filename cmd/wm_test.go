@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/distek/tmux-tools/lib/tmuxtest"
+)
+
+type geometry struct {
+	left, top, width, height int
+}
+
+func paneGeometry(srv *tmuxtest.Server, id string) geometry {
+	var g geometry
+	g.left, g.top, g.width, g.height = srv.Pane(id).Geometry()
+
+	return g
+}
+
+func TestMoveWindowInDir(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup [][]string
+		dir   string
+		want  map[string]geometry
+	}{
+		{
+			// Nothing below, so the pane takes the whole bottom
+			name: "two side by side to bottom",
+			setup: [][]string{
+				{"split-window", "-h", "-t", "%0"},
+			},
+			dir: "bottom",
+			want: map[string]geometry{
+				"%0": {0, 0, 80, 12},
+				"%1": {0, 13, 80, 11},
+			},
+		},
+		{
+			name: "two stacked to left",
+			setup: [][]string{
+				{"split-window", "-v", "-t", "%0"},
+			},
+			dir: "left",
+			want: map[string]geometry{
+				"%1": {0, 0, 39, 24},
+				"%0": {40, 0, 40, 24},
+			},
+		},
+		{
+			// %0 joins the column on its right, below %1
+			name: "into the neighbor on the right",
+			setup: [][]string{
+				{"split-window", "-h", "-t", "%0"},
+				{"split-window", "-v", "-t", "%1"},
+				{"select-pane", "-t", "%0"},
+			},
+			dir: "right",
+			want: map[string]geometry{
+				"%1": {0, 0, 80, 6},
+				"%0": {0, 7, 80, 5},
+				"%2": {0, 13, 80, 11},
+			},
+		},
+		{
+			// Already the whole left side, so there's nowhere to go
+			name: "full height left pane stays put",
+			setup: [][]string{
+				{"split-window", "-h", "-t", "%0"},
+				{"select-pane", "-t", "%0"},
+			},
+			dir: "left",
+			want: map[string]geometry{
+				"%0": {0, 0, 40, 24},
+				"%1": {41, 0, 39, 24},
+			},
+		},
+		{
+			name: "one pane stays put",
+			dir:  "top",
+			want: map[string]geometry{
+				"%0": {0, 0, 80, 24},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := fakeServer(t)
+
+			tmux(t, "new-session", "-d", "-s", "wm")
+
+			for _, args := range tt.setup {
+				tmux(t, args[0], args[1:]...)
+			}
+
+			moving := srv.Session("wm").Windows[0].Active()
+
+			moveWindowInDir(tt.dir)
+
+			w := srv.Session("wm").Windows[0]
+			if got := len(w.Panes()); got != len(tt.want) {
+				t.Fatalf("got %d panes, want %d", got, len(tt.want))
+			}
+
+			for id, want := range tt.want {
+				if got := paneGeometry(srv, id); got != want {
+					t.Errorf("%s: got %+v, want %+v", id, got, want)
+				}
+			}
+
+			if w.Active() != moving {
+				t.Errorf("active pane is %s, want %s", w.Active().Target(), moving.Target())
+			}
+		})
+	}
+}
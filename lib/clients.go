@@ -0,0 +1,45 @@
+package lib
+
+import "fmt"
+
+// ClientInfo is a client attached to the server (what list-clients shows),
+// not to be confused with Client, our own control mode connection
+type ClientInfo struct {
+	Name        string `json:"name" tmux:"client_name"`
+	TTY         string `json:"tty" tmux:"client_tty"`
+	PID         int    `json:"pid" tmux:"client_pid"`
+	Session     string `json:"session" tmux:"client_session"`
+	ControlMode bool   `json:"controlMode" tmux:"client_control_mode"`
+	Activity    int64  `json:"activity" tmux:"client_activity"`
+}
+
+// ListClients returns every client attached to the server
+func ListClients() ([]ClientInfo, error) {
+	ret, err := Query[ClientInfo](Command("list-clients"))
+	if err != nil {
+		return nil, fmt.Errorf("lib: ListClients: %s", err)
+	}
+
+	return ret, nil
+}
+
+// AttachedSessions returns the names of the sessions that have a client
+// attached. Control mode clients, like our own Client, aren't counted, which
+// is why this and not Session.Attached should be used to tell whether
+// someone is using a session.
+func AttachedSessions() (map[string]bool, error) {
+	clients, err := ListClients()
+	if err != nil {
+		return nil, fmt.Errorf("lib: AttachedSessions: %s", err)
+	}
+
+	ret := make(map[string]bool)
+
+	for _, c := range clients {
+		if !c.ControlMode {
+			ret[c.Session] = true
+		}
+	}
+
+	return ret, nil
+}
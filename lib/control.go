@@ -0,0 +1,331 @@
+package lib
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runner runs tmux commands
+type Runner interface {
+	Run(c *Cmd) (string, string, error)
+}
+
+type execRunner struct{}
+
+func (execRunner) Run(c *Cmd) (string, string, error) {
+	return c.runExec()
+}
+
+// Every Cmd that doesn't pick its own server goes through runner. Swap it
+// with SetRunner.
+var runner Runner = execRunner{}
+
+// SetRunner makes r run every command that uses GlobalArgs and returns the
+// Runner it replaced. Passing nil goes back to one tmux process per command.
+func SetRunner(r Runner) Runner {
+	old := runner
+
+	if r == nil {
+		r = execRunner{}
+	}
+
+	runner = r
+
+	return old
+}
+
+// How long Connect waits for tmux to attach
+const connectTimeout = time.Second * 2
+
+// ErrClientClosed is returned for commands sent to, or still waiting on, a
+// Client whose connection went away
+var ErrClientClosed = errors.New("lib: control client closed")
+
+type ctlReply struct {
+	lines  []string
+	failed bool
+}
+
+// Client is a tmux control mode (tmux -C) connection. Commands are written
+// to the one tmux process and replies are read back from its
+// %begin/%end/%error blocks, so nothing gets forked per command. It's safe to
+// use from several goroutines.
+type Client struct {
+	proc  *exec.Cmd
+	stdin io.WriteCloser
+
+	// mu guards writes to stdin and pending. tmux answers commands in the
+	// order it got them, so pending is a FIFO of the callers waiting.
+	mu      sync.Mutex
+	pending []chan ctlReply
+	closed  bool
+
+	// subMu guards the event subscribers, see Subscribe
+	subMu  sync.Mutex
+	subs   []*subscriber
+	exited bool
+
+	// attached is closed on the first %session-changed, which tmux sends
+	// once attach-session has gone through
+	attached     chan struct{}
+	attachedOnce sync.Once
+
+	done chan struct{}
+}
+
+// Connect starts a control mode client on the server from GlobalArgs,
+// attached to the session holding target. With an empty target tmux picks
+// the session.
+func Connect(target string) (*Client, error) {
+	attach := Command("attach-session")
+	if target != "" {
+		attach.Target(target)
+	}
+
+	// Without -u tmux only trusts the locale to decide whether the client
+	// is UTF-8, and for one that isn't it replaces anything non-printable
+	// in command output with '_', including the format separators
+	argv := []string{"-u", "-C"}
+
+	// $TMUX is dropped below, so the server it names has to be passed on
+	// unless GlobalArgs picks one
+	_, name := GlobalArgs["-L"]
+	_, path := GlobalArgs["-S"]
+	if sock, _, _ := strings.Cut(os.Getenv("TMUX"), ","); sock != "" && !name && !path {
+		argv = append(argv, "-S", sock)
+	}
+
+	argv = append(argv, attach.Argv()...)
+
+	c := &Client{
+		proc:     exec.Command("tmux", argv...),
+		attached: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	// tmux refuses to attach from inside one of its own panes when $TMUX
+	// is set, which is exactly where we usually run
+	for _, v := range os.Environ() {
+		if !strings.HasPrefix(v, "TMUX=") {
+			c.proc.Env = append(c.proc.Env, v)
+		}
+	}
+
+	var err error
+
+	c.stdin, err = c.proc.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("lib: Connect: StdinPipe: %s", err)
+	}
+
+	stdout, err := c.proc.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("lib: Connect: StdoutPipe: %s", err)
+	}
+
+	err = c.proc.Start()
+	if err != nil {
+		return nil, fmt.Errorf("lib: Connect: Start: %s", err)
+	}
+
+	go c.read(stdout)
+
+	// Commands sent before the attach finishes would run without a
+	// session, so wait for it
+	select {
+	case <-c.attached:
+	case <-c.done:
+		_ = c.proc.Wait()
+		return nil, fmt.Errorf("lib: Connect: tmux exited: %s", c.proc.ProcessState)
+	case <-time.After(connectTimeout):
+		_ = c.Close()
+		return nil, fmt.Errorf("lib: Connect: timed out waiting to attach")
+	}
+
+	// We never want pane output, and the client shouldn't change how big
+	// windows are. Older servers don't know these flags, which is fine.
+	_, _, _ = c.Run(Command("refresh-client").Opt("-f", "no-output,ignore-size"))
+
+	return c, nil
+}
+
+// Run sends c over the connection and waits for its reply. The returned
+// stderr holds the error tmux gave when the command failed.
+func (c *Client) Run(cmd *Cmd) (string, string, error) {
+	ch := make(chan ctlReply, 1)
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return "", "", ErrClientClosed
+	}
+
+	_, err := io.WriteString(c.stdin, cmd.String()+"\n")
+	if err != nil {
+		c.mu.Unlock()
+		return "", "", fmt.Errorf("lib: Client.Run: write: %s", err)
+	}
+
+	c.pending = append(c.pending, ch)
+	c.mu.Unlock()
+
+	var r ctlReply
+	var ok bool
+
+	select {
+	case r, ok = <-ch:
+	case <-c.done:
+		// The reply may have been delivered just before the reader quit
+		select {
+		case r, ok = <-ch:
+		default:
+		}
+	}
+
+	if !ok {
+		return "", "", ErrClientClosed
+	}
+
+	out := strings.Join(r.lines, "\n")
+
+	if r.failed {
+		return "", out, fmt.Errorf("lib: Client.Run: %s: %s", cmd.Name(), out)
+	}
+
+	return out, "", nil
+}
+
+// Close detaches the client and waits for tmux to exit
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		_ = c.stdin.Close()
+	}
+	c.mu.Unlock()
+
+	<-c.done
+
+	return c.proc.Wait()
+}
+
+// Done is closed once the connection has gone away
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Client) deliver(r ctlReply) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.pending) == 0 {
+		return
+	}
+
+	ch := c.pending[0]
+	c.pending = c.pending[1:]
+
+	ch <- r
+	close(ch)
+}
+
+func (c *Client) read(r io.Reader) {
+	sawExit := false
+
+	defer func() {
+		c.closeSubs(sawExit)
+
+		c.mu.Lock()
+		c.closed = true
+		for _, ch := range c.pending {
+			close(ch)
+		}
+		c.pending = nil
+		c.mu.Unlock()
+
+		close(c.done)
+	}()
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var (
+		inBlock bool
+		blockID string
+		ours    bool
+		lines   []string
+	)
+
+	for sc.Scan() {
+		line := sc.Text()
+
+		if inBlock {
+			// Guard lines are "%end <time> <number> <flags>", the same
+			// as the %begin that opened the block
+			if id, ok := strings.CutPrefix(line, "%end "); ok && guardID(id) == blockID {
+				if ours {
+					c.deliver(ctlReply{lines: lines})
+				}
+				inBlock = false
+				continue
+			}
+
+			if id, ok := strings.CutPrefix(line, "%error "); ok && guardID(id) == blockID {
+				if ours {
+					c.deliver(ctlReply{lines: lines, failed: true})
+				}
+				inBlock = false
+				continue
+			}
+
+			lines = append(lines, line)
+			continue
+		}
+
+		if id, ok := strings.CutPrefix(line, "%begin "); ok {
+			inBlock = true
+			blockID = guardID(id)
+			lines = nil
+
+			// The flags field is 1 for commands this client sent. The
+			// attach-session we started with comes back with 0.
+			fields := strings.Fields(id)
+			ours = len(fields) == 3 && fields[2] == "1"
+			continue
+		}
+
+		if !strings.HasPrefix(line, "%") {
+			continue
+		}
+
+		ev := parseEvent(line)
+		c.publish(ev)
+
+		if _, ok := ev.(SessionChangedEvent); ok {
+			c.attachedOnce.Do(func() { close(c.attached) })
+		}
+
+		if _, ok := ev.(ExitEvent); ok {
+			sawExit = true
+			return
+		}
+	}
+}
+
+// guardID drops the flags from a guard line's "<time> <number> <flags>" so
+// begin and end lines can be matched up
+func guardID(s string) string {
+	fields := strings.Fields(s)
+	if len(fields) < 2 {
+		return s
+	}
+
+	return fields[0] + " " + fields[1]
+}
@@ -0,0 +1,56 @@
+package lib
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// GetEnvironment returns the variables set in the session at target (the
+// current one if empty), without the ones update-environment copies from
+// whichever client attaches, since those belong to the client
+func GetEnvironment(target string) (map[string]string, error) {
+	c := Command("show-environment")
+	if target != "" {
+		c.Target(target)
+	}
+
+	o, e, err := c.Run()
+	if err != nil {
+		return nil, fmt.Errorf("lib: GetEnvironment: %s: %s", err, e)
+	}
+
+	u, _, err := Command("show-options").Flag("-gqv").Arg("update-environment").Run()
+	if err != nil {
+		return nil, fmt.Errorf("lib: GetEnvironment: %s", err)
+	}
+
+	fromClient := strings.Split(u, "\n")
+
+	ret := make(map[string]string)
+
+	for _, line := range strings.Split(o, "\n") {
+		// -NAME is a variable removed from the session
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || strings.HasPrefix(name, "-") || slices.Contains(fromClient, name) {
+			continue
+		}
+
+		ret[name] = value
+	}
+
+	return ret, nil
+}
+
+// SetEnvironment sets the variables in env in the session at target. Only
+// panes started afterwards see them.
+func SetEnvironment(target string, env map[string]string) error {
+	for name, value := range env {
+		_, e, err := Command("set-environment").Target(target).Arg(name, value).Run()
+		if err != nil {
+			return fmt.Errorf("lib: SetEnvironment: %s: %s: %s: %s", target, name, err, e)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,299 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Event is a notification sent by tmux to a control mode client. Use a type
+// switch to tell them apart.
+type Event interface {
+	event()
+}
+
+// WindowAddEvent is %window-add: a window was linked to the client's session
+type WindowAddEvent struct {
+	WindowID string
+}
+
+// LayoutChangeEvent is %layout-change: panes in the window were created,
+// killed or resized
+type LayoutChangeEvent struct {
+	WindowID      string
+	Layout        string
+	VisibleLayout string
+	Flags         string
+}
+
+// PaneModeChangedEvent is %pane-mode-changed: the pane entered or left a mode
+// such as copy-mode
+type PaneModeChangedEvent struct {
+	PaneID string
+}
+
+// SessionChangedEvent is %session-changed: the client now shows another
+// session
+type SessionChangedEvent struct {
+	SessionID string
+	Name      string
+}
+
+// ClientDetachedEvent is %client-detached: some client detached from the
+// server
+type ClientDetachedEvent struct {
+	Client string
+}
+
+// ExitEvent is %exit: the control client is going away. It's also sent when
+// the connection drops without tmux saying so.
+type ExitEvent struct {
+	Reason string
+}
+
+// SubscriptionChangedEvent is %subscription-changed: a format registered with
+// SubscribeFormat has a new value. Fields tmux doesn't fill in for the
+// subscription's target are "-".
+type SubscriptionChangedEvent struct {
+	Name        string
+	SessionID   string
+	WindowID    string
+	WindowIndex string
+	PaneID      string
+	Value       string
+}
+
+// RawEvent is any other notification, e.g. %window-close or
+// %sessions-changed. Name doesn't include the leading '%'.
+type RawEvent struct {
+	Name string
+	Args []string
+}
+
+func (WindowAddEvent) event()           {}
+func (LayoutChangeEvent) event()        {}
+func (PaneModeChangedEvent) event()     {}
+func (SessionChangedEvent) event()      {}
+func (ClientDetachedEvent) event()      {}
+func (ExitEvent) event()                {}
+func (SubscriptionChangedEvent) event() {}
+func (RawEvent) event()                 {}
+
+// parseEvent turns a notification line (outside of any %begin block) into
+// an Event
+func parseEvent(line string) Event {
+	name, rest, _ := strings.Cut(strings.TrimPrefix(line, "%"), " ")
+
+	switch name {
+	case "window-add":
+		return WindowAddEvent{WindowID: rest}
+	case "layout-change":
+		f := strings.SplitN(rest, " ", 4)
+		for len(f) < 4 {
+			f = append(f, "")
+		}
+
+		return LayoutChangeEvent{
+			WindowID:      f[0],
+			Layout:        f[1],
+			VisibleLayout: f[2],
+			Flags:         f[3],
+		}
+	case "pane-mode-changed":
+		return PaneModeChangedEvent{PaneID: rest}
+	case "session-changed":
+		id, sessName, _ := strings.Cut(rest, " ")
+		return SessionChangedEvent{SessionID: id, Name: sessName}
+	case "client-detached":
+		return ClientDetachedEvent{Client: rest}
+	case "exit":
+		return ExitEvent{Reason: rest}
+	case "subscription-changed":
+		head, value, _ := strings.Cut(rest, " : ")
+
+		f := strings.Fields(head)
+		for len(f) < 5 {
+			f = append(f, "-")
+		}
+
+		return SubscriptionChangedEvent{
+			Name:        f[0],
+			SessionID:   f[1],
+			WindowID:    f[2],
+			WindowIndex: f[3],
+			PaneID:      f[4],
+			Value:       value,
+		}
+	}
+
+	var args []string
+	if rest != "" {
+		args = strings.Split(rest, " ")
+	}
+
+	return RawEvent{Name: name, Args: args}
+}
+
+// subscriber queues events so a slow reader never holds up command replies
+type subscriber struct {
+	ch   chan Event
+	wake chan struct{}
+	stop chan struct{}
+
+	mu     sync.Mutex
+	queue  []Event
+	closed bool
+}
+
+func newSubscriber() *subscriber {
+	s := &subscriber{
+		ch:   make(chan Event),
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+	}
+
+	go s.forward()
+
+	return s
+}
+
+func (s *subscriber) push(ev Event) {
+	s.mu.Lock()
+	s.queue = append(s.queue, ev)
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// finish closes the channel once everything queued has been read
+func (s *subscriber) finish() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscriber) forward() {
+	defer close(s.ch)
+
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			closed := s.closed
+			s.mu.Unlock()
+
+			if closed {
+				return
+			}
+
+			select {
+			case <-s.wake:
+			case <-s.stop:
+				return
+			}
+
+			continue
+		}
+
+		ev := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		select {
+		case s.ch <- ev:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Subscribe returns a channel that gets every notification from now on. It
+// is closed after the client's ExitEvent, or once cancel is called.
+func (c *Client) Subscribe() (<-chan Event, func()) {
+	s := newSubscriber()
+
+	c.subMu.Lock()
+	if c.exited {
+		s.push(ExitEvent{Reason: "client closed"})
+		s.finish()
+	} else {
+		c.subs = append(c.subs, s)
+	}
+	c.subMu.Unlock()
+
+	var once sync.Once
+
+	cancel := func() {
+		once.Do(func() {
+			c.subMu.Lock()
+			for i, v := range c.subs {
+				if v == s {
+					c.subs = append(c.subs[:i], c.subs[i+1:]...)
+					break
+				}
+			}
+			c.subMu.Unlock()
+
+			close(s.stop)
+		})
+	}
+
+	return s.ch, cancel
+}
+
+// SubscribeFormat asks tmux to send a SubscriptionChangedEvent called name
+// whenever format changes for target. target is a pane (%1), window (@1) or
+// session ($1), "%*" or "@*" for every pane or window, or "" for the
+// client's session. tmux checks subscriptions about once a second.
+func (c *Client) SubscribeFormat(name, target, format string) error {
+	_, _, err := c.Run(Command("refresh-client").Opt("-B", fmt.Sprintf("%s:%s:%s", name, target, format)))
+	if err != nil {
+		return fmt.Errorf("lib: SubscribeFormat: %s", err)
+	}
+
+	return nil
+}
+
+// UnsubscribeFormat removes the subscription called name
+func (c *Client) UnsubscribeFormat(name string) error {
+	_, _, err := c.Run(Command("refresh-client").Opt("-B", name))
+	if err != nil {
+		return fmt.Errorf("lib: UnsubscribeFormat: %s", err)
+	}
+
+	return nil
+}
+
+func (c *Client) publish(ev Event) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	for _, s := range c.subs {
+		s.push(ev)
+	}
+}
+
+// closeSubs sends a final ExitEvent (unless tmux already sent one) and
+// closes every subscription
+func (c *Client) closeSubs(sawExit bool) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	c.exited = true
+
+	for _, s := range c.subs {
+		if !sawExit {
+			s.push(ExitEvent{Reason: "connection lost"})
+		}
+		s.finish()
+	}
+
+	c.subs = nil
+}
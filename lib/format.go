@@ -0,0 +1,227 @@
+package lib
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Format output is split up with the ASCII unit and record separators. Unlike
+// ',' or '%' they don't turn up in paths or window names.
+const (
+	fieldSep  = "\x1f"
+	recordSep = "\x1e"
+)
+
+// formatField is one tagged struct field and the format variable it holds
+type formatField struct {
+	index []int
+	name  string
+}
+
+type formatSpec struct {
+	fields []formatField
+	format string
+}
+
+var formatSpecs sync.Map
+
+// specFor reads the `tmux:"variable"` tags on T. Untagged fields (and ones
+// tagged "-") are skipped, embedded structs are walked into.
+func specFor(t reflect.Type) (*formatSpec, error) {
+	if s, ok := formatSpecs.Load(t); ok {
+		return s.(*formatSpec), nil
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("lib: specFor: %s is not a struct", t)
+	}
+
+	spec := &formatSpec{}
+
+	var walk func(t reflect.Type, index []int) error
+	walk = func(t reflect.Type, index []int) error {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			idx := append(append([]int{}, index...), i)
+
+			if f.Anonymous && f.Type.Kind() == reflect.Struct {
+				if err := walk(f.Type, idx); err != nil {
+					return err
+				}
+				continue
+			}
+
+			name := f.Tag.Get("tmux")
+			if name == "" || name == "-" {
+				continue
+			}
+
+			switch f.Type.Kind() {
+			case reflect.String, reflect.Bool,
+				reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			default:
+				return fmt.Errorf("lib: specFor: %s.%s: can't decode into %s", t, f.Name, f.Type)
+			}
+
+			spec.fields = append(spec.fields, formatField{index: idx, name: name})
+		}
+
+		return nil
+	}
+
+	if err := walk(t, nil); err != nil {
+		return nil, err
+	}
+
+	if len(spec.fields) == 0 {
+		return nil, fmt.Errorf("lib: specFor: %s has no tmux tags", t)
+	}
+
+	var bld strings.Builder
+	for i, f := range spec.fields {
+		if i != 0 {
+			bld.WriteString(fieldSep)
+		}
+
+		bld.WriteString("#{")
+		bld.WriteString(f.name)
+		bld.WriteString("}")
+	}
+	bld.WriteString(recordSep)
+
+	spec.format = bld.String()
+
+	formatSpecs.Store(t, spec)
+
+	return spec, nil
+}
+
+// FormatFor returns the -F format that prints every tagged field of T
+func FormatFor[T any]() (string, error) {
+	spec, err := specFor(reflect.TypeFor[T]())
+	if err != nil {
+		return "", err
+	}
+
+	return spec.format, nil
+}
+
+func setField(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		v.SetBool(TmuxBool(s))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// Formats that don't apply (copy_cursor_y outside of copy mode)
+		// come back empty
+		if s == "" {
+			return nil
+		}
+
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if s == "" {
+			return nil
+		}
+
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		v.SetUint(n)
+	}
+
+	return nil
+}
+
+// ParseRecords decodes the output of a command run with FormatFor[T]
+func ParseRecords[T any](out string) ([]T, error) {
+	spec, err := specFor(reflect.TypeFor[T]())
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []T
+
+	for rec := range strings.SplitSeq(out, recordSep) {
+		rec = strings.TrimPrefix(rec, "\n")
+		if rec == "" {
+			continue
+		}
+
+		vals := strings.Split(rec, fieldSep)
+		if len(vals) != len(spec.fields) {
+			return nil, fmt.Errorf("lib: ParseRecords: got %d fields, want %d: %q", len(vals), len(spec.fields), rec)
+		}
+
+		var t T
+		tv := reflect.ValueOf(&t).Elem()
+
+		for i, f := range spec.fields {
+			err := setField(tv.FieldByIndex(f.index), vals[i])
+			if err != nil {
+				return nil, fmt.Errorf("lib: ParseRecords: %s=%q: %s", f.name, vals[i], err)
+			}
+		}
+
+		ret = append(ret, t)
+	}
+
+	return ret, nil
+}
+
+// Query runs c (list-panes, list-windows, ...) with a -F built from the
+// `tmux:"..."` struct tags on T and decodes one T per line of output:
+//
+//	type paneInfo struct {
+//		ID   string `tmux:"pane_id"`
+//		Zoom bool   `tmux:"window_zoomed_flag"`
+//	}
+//
+//	panes, err := lib.Query[paneInfo](lib.Command("list-panes"))
+func Query[T any](c *Cmd) ([]T, error) {
+	format, err := FormatFor[T]()
+	if err != nil {
+		return nil, err
+	}
+
+	o, e, err := c.Format(format).Run()
+	if err != nil {
+		return nil, fmt.Errorf("lib: Query: %s: %s: %s", c.Name(), err, e)
+	}
+
+	return ParseRecords[T](o)
+}
+
+// QueryOne is Query for display-message on target (or the current pane if
+// target is empty), which only ever gives back one T
+func QueryOne[T any](target string) (T, error) {
+	var zero T
+
+	c := Command("display-message").Flag("-p")
+	if target != "" {
+		c.Target(target)
+	}
+
+	ret, err := Query[T](c)
+	if err != nil {
+		return zero, err
+	}
+
+	if len(ret) != 1 {
+		return zero, fmt.Errorf("lib: QueryOne: %s: got %d records", target, len(ret))
+	}
+
+	return ret[0], nil
+}
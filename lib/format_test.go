@@ -0,0 +1,149 @@
+package lib
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type formatRecord struct {
+	Name   string `tmux:"window_name"`
+	Index  int    `tmux:"window_index"`
+	Active bool   `tmux:"window_active"`
+	Skip   string
+}
+
+// records joins fields the way tmux prints a FormatFor format, one record per
+// line
+func records(recs ...[]string) string {
+	var lines []string
+	for _, r := range recs {
+		lines = append(lines, strings.Join(r, fieldSep)+recordSep)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func TestParseRecords(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		want    []formatRecord
+		wantErr bool
+	}{
+		{
+			name: "plain",
+			out:  records([]string{"editor", "0", "1"}, []string{"shell", "3", "0"}),
+			want: []formatRecord{{Name: "editor", Active: true}, {Name: "shell", Index: 3}},
+		},
+		{
+			name: "separators tmux would print in a name",
+			out:  records([]string{"a,b %1 #{x}", "1", "0"}, []string{"two\nlines\n", "2", "1"}),
+			want: []formatRecord{{Name: "a,b %1 #{x}", Index: 1}, {Name: "two\nlines\n", Index: 2, Active: true}},
+		},
+		{
+			// Formats that don't apply come back empty
+			name: "empty number",
+			out:  records([]string{"", "", ""}),
+			want: []formatRecord{{}},
+		},
+		{
+			name: "nothing",
+			out:  "",
+		},
+		{
+			name:    "comma in a number",
+			out:     records([]string{"x", "1,2", "0"}),
+			wantErr: true,
+		},
+		{
+			name:    "percent in a number",
+			out:     records([]string{"x", "%1", "0"}),
+			wantErr: true,
+		},
+		{
+			name:    "newline in a number",
+			out:     records([]string{"x", "1\n2", "0"}),
+			wantErr: true,
+		},
+		{
+			name:    "missing field",
+			out:     records([]string{"x", "1"}),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRecords[formatRecord](tt.out)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+type runnerFunc func(c *Cmd) (string, string, error)
+
+func (f runnerFunc) Run(c *Cmd) (string, string, error) {
+	return f(c)
+}
+
+func TestQuery(t *testing.T) {
+	format, err := FormatFor[formatRecord]()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "#{window_name}\x1f#{window_index}\x1f#{window_active}\x1e"; format != want {
+		t.Errorf("format: got %q, want %q", format, want)
+	}
+
+	out := records([]string{"100%, done\n", "4", "1"})
+
+	var args []string
+
+	old := SetRunner(runnerFunc(func(c *Cmd) (string, string, error) {
+		args = c.Args()
+
+		return out, "", nil
+	}))
+	defer SetRunner(old)
+
+	got, err := Query[formatRecord](Command("list-windows").Target("=dev"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []formatRecord{{Name: "100%, done\n", Index: 4, Active: true}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if !slices.Equal(args, []string{"-t", "=dev", "-F", format}) {
+		t.Errorf("ran list-windows %q", args)
+	}
+
+	// Errors from tmux come back with its stderr
+	SetRunner(runnerFunc(func(c *Cmd) (string, string, error) {
+		return "", "can't find session: dev", errors.New("exit status 1")
+	}))
+
+	_, err = Query[formatRecord](Command("list-windows").Target("=dev"))
+	if err == nil || !strings.Contains(err.Error(), "can't find session") {
+		t.Errorf("got error %v", err)
+	}
+}
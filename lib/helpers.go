@@ -10,70 +10,21 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 )
 
-func runCmd(cmd string) (string, string, error) {
-	c := exec.Command("sh", "-c", cmd)
-
-	outBuf := bytes.NewBuffer([]byte{})
-	errBuf := bytes.NewBuffer([]byte{})
-
-	c.Stdout = outBuf
-	c.Stderr = errBuf
-
-	err := c.Run()
-
-	return strings.TrimSuffix(outBuf.String(), "\n"), strings.TrimSuffix(errBuf.String(), "\n"), err
-}
-
-func formatArgs(args map[string]string) string {
-	var bld strings.Builder
-	bld.WriteString(" ")
-	for k, v := range args {
-		bld.WriteString(k)
-		bld.WriteString(" ")
-		if v != "" {
-			bld.WriteString(v)
-			bld.WriteString(" ")
-		}
-	}
-
-	bld.WriteString(" ")
-
-	return bld.String()
-}
-
-func Tmux(args map[string]string, cmd string, cmdArgs map[string]string, trailingCmd string) (string, string, error) {
-	var argsStr string
-	var cmdArgsStr string
-
-	if len(args) > 0 {
-		argsStr = formatArgs(args)
-	}
-
-	if len(cmdArgs) > 0 {
-		cmdArgsStr = formatArgs(cmdArgs)
-	}
-
-	return runCmd("tmux " + argsStr + cmd + " " + cmdArgsStr + " " + trailingCmd)
-}
-
 // KillServer kills the server at sock or the current server if sock is
 // an empty string
 func KillServer(sock string) {
-	tempSock, ok := GlobalArgs["-S"]
+	c := Command("kill-server")
 	if sock != "" {
-		GlobalArgs["-S"] = sock
-	}
-	_, _, err := Tmux(GlobalArgs, "kill-server", map[string]string{}, "")
-
-	if ok {
-		GlobalArgs["-S"] = tempSock
+		c.Socket(sock)
 	}
 
+	_, _, err := c.Run()
 	if err != nil {
 		log.Println(err)
 	}
@@ -86,25 +37,36 @@ func SockExists(sock string) bool {
 }
 
 // SockHasAttached returns true if a client is attached to the sock or the
-// current socket if sock is an empty string
+// current socket if sock is an empty string. Control mode clients (like our
+// own lib.Client) don't count.
 func SockHasAttached(sock string) bool {
-	o, _, err := Tmux(map[string]string{"-S": sock}, "ls", map[string]string{
-		"-F": "\"#{session_attached}\"",
-	}, "")
+	c := Command("list-clients").Format("#{client_control_mode}")
+	if sock != "" {
+		c.Socket(sock)
+	}
+
+	o, _, err := c.Run()
 	if err != nil {
 		log.Println(err)
 		return false
 	}
 
-	if strings.Contains(string(o), "1") {
-		return true
+	for l := range strings.SplitSeq(o, "\n") {
+		if l == "0" {
+			return true
+		}
 	}
 
 	return false
 }
 
 func SockActive(sock string) bool {
-	_, e, _ := Tmux(map[string]string{"-S": sock}, "ls", nil, "")
+	c := Command("ls")
+	if sock != "" {
+		c.Socket(sock)
+	}
+
+	_, e, _ := c.Run()
 
 	return !strings.HasPrefix(e, "no server running on")
 }
@@ -170,11 +132,46 @@ func GetProcCmd(pid int) (string, error) {
 	return strings.TrimSuffix(string(out), "\n"), nil
 }
 
-func Fzf(list []string) (string, error) {
+// FzfOption adds to fzf's command line
+type FzfOption func(args []string) []string
+
+// FzfPreview shows the output of the shell command cmd next to the list. fzf
+// replaces {} in cmd with the highlighted line, quoted.
+func FzfPreview(cmd string) FzfOption {
+	return func(args []string) []string {
+		return append(args, "--preview", cmd)
+	}
+}
+
+// FzfFlags passes flags to fzf as they are
+func FzfFlags(flags ...string) FzfOption {
+	return func(args []string) []string {
+		return append(args, flags...)
+	}
+}
+
+// Fzf lets the user pick one of list with fzf. Nothing picked is an empty
+// string and no error. Without fzf installed it falls back to Pick, which
+// only takes the --prompt from opts.
+func Fzf(list []string, opts ...FzfOption) (string, error) {
 	data := bytes.NewBuffer([]byte(strings.Join(list, "\n")))
 
+	var args []string
+	for _, opt := range opts {
+		args = opt(args)
+	}
+
+	if _, err := exec.LookPath("fzf"); err != nil {
+		prompt := "> "
+		if i := slices.Index(args, "--prompt"); i >= 0 && i+1 < len(args) {
+			prompt = args[i+1]
+		}
+
+		return Pick(list, prompt)
+	}
+
 	var result strings.Builder
-	cmd := exec.Command("fzf")
+	cmd := exec.Command("fzf", args...)
 	cmd.Stdout = &result
 	cmd.Stderr = os.Stderr
 	stdin, err := cmd.StdinPipe()
@@ -0,0 +1,353 @@
+// Package layout reads and writes tmux window layout strings (the
+// #{window_layout} format) such as
+//
+//	c195,80x24,0,0[80x12,0,0,0,80x11,0,13,1]
+//
+// A layout is a tree of cells. Each cell is a pane, or a container splitting
+// its area left-right ({}) or top-bottom ([]) with a one cell border between
+// children.
+package layout
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Type is the kind of cell
+type Type int
+
+const (
+	Pane Type = iota
+	LeftRight
+	TopBottom
+)
+
+// Cell is one node in a layout tree
+type Cell struct {
+	Type Type
+
+	Width, Height int
+	X, Y          int
+
+	// PaneID is the number from the pane's ID (3 for %3). Only set for
+	// Pane cells, -1 otherwise.
+	PaneID int
+
+	Children []*Cell
+}
+
+// Checksum is the checksum tmux puts in front of a layout body
+func Checksum(body string) uint16 {
+	var csum uint16
+
+	for i := 0; i < len(body); i++ {
+		csum = (csum >> 1) + ((csum & 1) << 15)
+		csum += uint16(body[i])
+	}
+
+	return csum
+}
+
+// Parse reads a layout string. The checksum is optional, but when it's there
+// it has to match.
+func Parse(s string) (*Cell, error) {
+	body := s
+
+	if sum, rest, ok := strings.Cut(s, ","); ok && len(sum) == 4 && !strings.Contains(sum, "x") {
+		want, err := strconv.ParseUint(sum, 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("layout: Parse: bad checksum: %s", sum)
+		}
+
+		if got := Checksum(rest); uint16(want) != got {
+			return nil, fmt.Errorf("layout: Parse: checksum mismatch: have %04x, want %04x", got, want)
+		}
+
+		body = rest
+	}
+
+	p := parser{s: body}
+
+	c, err := p.cell()
+	if err != nil {
+		return nil, fmt.Errorf("layout: Parse: %s", err)
+	}
+
+	if p.pos != len(p.s) {
+		return nil, fmt.Errorf("layout: Parse: trailing data at %d: %s", p.pos, p.s[p.pos:])
+	}
+
+	return c, nil
+}
+
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) peek() byte {
+	if p.pos >= len(p.s) {
+		return 0
+	}
+
+	return p.s[p.pos]
+}
+
+func (p *parser) expect(b byte) error {
+	if p.peek() != b {
+		return fmt.Errorf("expected %q at %d", b, p.pos)
+	}
+
+	p.pos++
+
+	return nil
+}
+
+func (p *parser) number() (int, error) {
+	start := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+		p.pos++
+	}
+
+	if start == p.pos {
+		return 0, fmt.Errorf("expected a number at %d", start)
+	}
+
+	return strconv.Atoi(p.s[start:p.pos])
+}
+
+// cell reads "WxH,X,Y" followed by ",ID", "{...}" or "[...]"
+func (p *parser) cell() (*Cell, error) {
+	c := &Cell{PaneID: -1}
+
+	var err error
+
+	steps := []struct {
+		dst *int
+		sep byte
+	}{
+		{&c.Width, 'x'},
+		{&c.Height, ','},
+		{&c.X, ','},
+		{&c.Y, 0},
+	}
+
+	for _, st := range steps {
+		*st.dst, err = p.number()
+		if err != nil {
+			return nil, err
+		}
+
+		if st.sep != 0 {
+			if err := p.expect(st.sep); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var closer byte
+
+	switch p.peek() {
+	case ',':
+		p.pos++
+		c.Type = Pane
+		c.PaneID, err = p.number()
+		return c, err
+	case '{':
+		c.Type = LeftRight
+		closer = '}'
+	case '[':
+		c.Type = TopBottom
+		closer = ']'
+	default:
+		return nil, fmt.Errorf("unexpected %q at %d", p.peek(), p.pos)
+	}
+
+	p.pos++
+
+	for {
+		child, err := p.cell()
+		if err != nil {
+			return nil, err
+		}
+
+		c.Children = append(c.Children, child)
+
+		if p.peek() == ',' {
+			p.pos++
+			continue
+		}
+
+		if err := p.expect(closer); err != nil {
+			return nil, err
+		}
+
+		return c, nil
+	}
+}
+
+// Body is the layout without its checksum
+func (c *Cell) Body() string {
+	var bld strings.Builder
+	c.write(&bld)
+
+	return bld.String()
+}
+
+// String is the layout with its checksum, ready for select-layout
+func (c *Cell) String() string {
+	body := c.Body()
+
+	return fmt.Sprintf("%04x,%s", Checksum(body), body)
+}
+
+func (c *Cell) write(bld *strings.Builder) {
+	fmt.Fprintf(bld, "%dx%d,%d,%d", c.Width, c.Height, c.X, c.Y)
+
+	if c.Type == Pane {
+		fmt.Fprintf(bld, ",%d", c.PaneID)
+		return
+	}
+
+	open, closer := "{", "}"
+	if c.Type == TopBottom {
+		open, closer = "[", "]"
+	}
+
+	bld.WriteString(open)
+	for i, child := range c.Children {
+		if i != 0 {
+			bld.WriteString(",")
+		}
+		child.write(bld)
+	}
+	bld.WriteString(closer)
+}
+
+// Panes returns the pane cells in layout order, which is the order tmux
+// gives panes their index in
+func (c *Cell) Panes() []*Cell {
+	if c.Type == Pane {
+		return []*Cell{c}
+	}
+
+	var ret []*Cell
+	for _, child := range c.Children {
+		ret = append(ret, child.Panes()...)
+	}
+
+	return ret
+}
+
+// Clone returns a deep copy of c
+func (c *Cell) Clone() *Cell {
+	ret := *c
+	ret.Children = make([]*Cell, len(c.Children))
+
+	for i, child := range c.Children {
+		ret.Children[i] = child.Clone()
+	}
+
+	return &ret
+}
+
+// minSize is the smallest c can get: one cell per pane plus the borders
+func (c *Cell) minSize() (int, int) {
+	if c.Type == Pane {
+		return 1, 1
+	}
+
+	w, h := 0, 0
+	for _, child := range c.Children {
+		cw, ch := child.minSize()
+
+		if c.Type == LeftRight {
+			w += cw
+			h = max(h, ch)
+		} else {
+			w = max(w, cw)
+			h += ch
+		}
+	}
+
+	if c.Type == LeftRight {
+		w += len(c.Children) - 1
+	} else {
+		h += len(c.Children) - 1
+	}
+
+	return w, h
+}
+
+// Scale resizes the layout to width x height, keeping every split in
+// proportion, and fixes up the offsets to match
+func (c *Cell) Scale(width, height int) error {
+	mw, mh := c.minSize()
+	if width < mw || height < mh {
+		return fmt.Errorf("layout: Scale: %dx%d is too small, need at least %dx%d", width, height, mw, mh)
+	}
+
+	c.resize(0, 0, width, height)
+
+	return nil
+}
+
+func (c *Cell) size(t Type) int {
+	if t == LeftRight {
+		return c.Width
+	}
+
+	return c.Height
+}
+
+func (c *Cell) resize(x, y, width, height int) {
+	c.X, c.Y, c.Width, c.Height = x, y, width, height
+
+	if c.Type == Pane {
+		return
+	}
+
+	avail := c.size(c.Type) - (len(c.Children) - 1)
+
+	total := 0
+	for _, child := range c.Children {
+		total += max(child.size(c.Type), 1)
+	}
+
+	// Every child after this one needs room for its minimum size too
+	need := make([]int, len(c.Children)+1)
+	for i := len(c.Children) - 1; i >= 0; i-- {
+		mw, mh := c.Children[i].minSize()
+		if c.Type == LeftRight {
+			need[i] = need[i+1] + mw
+		} else {
+			need[i] = need[i+1] + mh
+		}
+	}
+
+	offset := 0
+	used := 0
+	for i, child := range c.Children {
+		mw, mh := child.minSize()
+		least := mh
+		if c.Type == LeftRight {
+			least = mw
+		}
+
+		n := max(child.size(c.Type), 1) * avail / total
+		if i == len(c.Children)-1 {
+			n = avail - used
+		}
+		n = min(max(n, least), avail-used-need[i+1])
+
+		if c.Type == LeftRight {
+			child.resize(x+offset, y, n, height)
+		} else {
+			child.resize(x, y+offset, width, n)
+		}
+
+		used += n
+		offset += n + 1
+	}
+}
@@ -0,0 +1,176 @@
+package layout
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Layouts as tmux 3.3a printed them for an 80x24 window
+var realLayouts = []string{
+	"b25d,80x24,0,0,0",
+	"8205,80x24,0,0{40x24,0,0,0,39x24,41,0,1}",
+	"d67e,80x24,0,0{40x24,0,0,0,39x24,41,0[39x12,41,0,1,39x11,41,13,2]}",
+	"7fc8,80x24,0,0[80x12,0,0{40x12,0,0,0,39x12,41,0[39x6,41,0,1,39x5,41,7,2]},80x11,0,13,3]",
+	"30d6,80x24,0,0[80x11,0,0{39x11,0,0,0,40x11,40,0,1},80x12,0,12{39x12,0,12,2,40x12,40,12,3}]",
+}
+
+func TestChecksum(t *testing.T) {
+	for _, s := range realLayouts {
+		sum, body, _ := strings.Cut(s, ",")
+
+		if got := fmt.Sprintf("%04x", Checksum(body)); got != sum {
+			t.Errorf("%s: got %s", s, got)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, s := range realLayouts {
+		c, err := Parse(s)
+		if err != nil {
+			t.Errorf("%s: %s", s, err)
+			continue
+		}
+
+		if got := c.String(); got != s {
+			t.Errorf("got %s, want %s", got, s)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	c, err := Parse(realLayouts[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// [ {%0, [%1, %2]}, %3 ]
+	top := c.Children[0]
+	right := top.Children[1]
+
+	switch {
+	case c.Type != TopBottom || len(c.Children) != 2:
+		t.Errorf("root: %+v", c)
+	case top.Type != LeftRight || top.Width != 80 || top.Height != 12:
+		t.Errorf("top half: %+v", top)
+	case right.Type != TopBottom || right.X != 41 || len(right.Children) != 2:
+		t.Errorf("top right column: %+v", right)
+	case right.Children[1].Y != 7 || right.Children[1].Height != 5:
+		t.Errorf("%%2: %+v", right.Children[1])
+	case c.PaneID != -1 || c.Children[1].PaneID != 3:
+		t.Errorf("pane IDs: root %d, bottom %d", c.PaneID, c.Children[1].PaneID)
+	}
+
+	var ids []int
+	for _, p := range c.Panes() {
+		ids = append(ids, p.PaneID)
+	}
+
+	if !slices.Equal(ids, []int{0, 1, 2, 3}) {
+		t.Errorf("panes in order %v", ids)
+	}
+
+	// Without the checksum it's the same tree
+	_, body, _ := strings.Cut(realLayouts[3], ",")
+
+	bare, err := Parse(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bare.String() != realLayouts[3] {
+		t.Errorf("without checksum: got %s", bare.String())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"0000,80x24,0,0,0",
+		"zzzz,80x24,0,0,0",
+		"80x24,0,0",
+		"80x24,0,0,0]",
+		"80x24,0,0{40x24,0,0,0,39x24,41,0,1",
+		"80x24,0,0{40x24,0,0,0,39x24,41,0,1]",
+	}
+
+	for _, s := range tests {
+		if c, err := Parse(s); err == nil {
+			t.Errorf("%q parsed as %s", s, c.Body())
+		}
+	}
+}
+
+func TestScale(t *testing.T) {
+	tests := []struct {
+		name          string
+		layout        string
+		width, height int
+		want          string
+	}{
+		{
+			name:   "wider",
+			layout: "80x24,0,0{40x24,0,0,0,39x24,41,0,1}",
+			width:  120, height: 24,
+			want: "120x24,0,0{60x24,0,0,0,59x24,61,0,1}",
+		},
+		{
+			name:   "nested, shorter",
+			layout: "80x24,0,0{40x24,0,0,0,39x24,41,0[39x12,41,0,1,39x11,41,13,2]}",
+			width:  80, height: 5,
+			want: "80x5,0,0{40x5,0,0,0,39x5,41,0[39x2,41,0,1,39x2,41,3,2]}",
+		},
+		{
+			// Proportionally the narrow panes would be 0 wide
+			name:   "small panes kept at one cell",
+			layout: "80x24,0,0{1x24,0,0,0,1x24,2,0,1,76x24,4,0,2}",
+			width:  7, height: 24,
+			want: "7x24,0,0{1x24,0,0,0,1x24,2,0,1,3x24,4,0,2}",
+		},
+		{
+			// The big pane can't take the room the ones after it need
+			name:   "big pane first gives way",
+			layout: "80x24,0,0{76x24,0,0,0,1x24,77,0,1,1x24,79,0,2}",
+			width:  7, height: 24,
+			want: "7x24,0,0{3x24,0,0,0,1x24,4,0,1,1x24,6,0,2}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Parse(tt.layout)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = c.Scale(tt.width, tt.height)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := c.Body(); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScaleTooSmall(t *testing.T) {
+	c, err := Parse("80x24,0,0{40x24,0,0,0,39x24,41,0[39x12,41,0,1,39x11,41,13,2]}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Three columns wide (two panes and a border), three rows high
+	for _, size := range [][2]int{{2, 24}, {80, 2}} {
+		if err := c.Scale(size[0], size[1]); err == nil {
+			t.Errorf("scaled to %dx%d", size[0], size[1])
+		}
+	}
+
+	if err := c.Scale(3, 3); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,81 @@
+package lib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// OptionScope is which kind of option show-options and set-option work with
+type OptionScope string
+
+const (
+	OptionSession OptionScope = ""
+	OptionWindow  OptionScope = "-w"
+	OptionPane    OptionScope = "-p"
+)
+
+func optionCommand(name string, scope OptionScope) *Cmd {
+	c := Command(name)
+	if scope != OptionSession {
+		c.Flag(string(scope))
+	}
+
+	return c
+}
+
+// GetOptions returns the options in names that are set on target (the current
+// session, window or pane if empty) itself, not inherited from the global
+// ones. Unknown options are left out. Array options come back one item per
+// line.
+func GetOptions(target string, scope OptionScope, names []string) (map[string]string, error) {
+	ret := make(map[string]string)
+
+	for _, name := range names {
+		c := optionCommand("show-options", scope).Flag("-qv")
+		if target != "" {
+			c.Target(target)
+		}
+
+		o, e, err := c.Arg(name).Run()
+		if err != nil {
+			return nil, fmt.Errorf("lib: GetOptions: %s: %s: %s: %s", target, name, err, e)
+		}
+
+		if o != "" {
+			ret[name] = o
+		}
+	}
+
+	return ret, nil
+}
+
+// SetOption sets the option on target. A value with more than one line, as
+// GetOptions returns array options, sets one item per line.
+func SetOption(target string, scope OptionScope, name, value string) error {
+	if !strings.Contains(value, "\n") {
+		_, e, err := optionCommand("set-option", scope).Target(target).Arg(name, value).Run()
+		if err != nil {
+			return fmt.Errorf("lib: SetOption: %s: %s: %s: %s", target, name, err, e)
+		}
+
+		return nil
+	}
+
+	// Start from an empty array so no items are left over from before
+	_, e, err := optionCommand("set-option", scope).Flag("-u").Target(target).Arg(name).Run()
+	if err != nil {
+		return fmt.Errorf("lib: SetOption: %s: %s: %s: %s", target, name, err, e)
+	}
+
+	for i, item := range strings.Split(value, "\n") {
+		itemName := name + "[" + strconv.Itoa(i) + "]"
+
+		_, e, err := optionCommand("set-option", scope).Target(target).Arg(itemName, item).Run()
+		if err != nil {
+			return fmt.Errorf("lib: SetOption: %s: %s: %s: %s", target, itemName, err, e)
+		}
+	}
+
+	return nil
+}
@@ -4,8 +4,6 @@ import (
 	"fmt"
 	"log"
 	"regexp"
-	"strconv"
-	"strings"
 )
 
 type PaneMode string
@@ -15,213 +13,80 @@ const (
 )
 
 type Pane struct {
-	Index       int      `json:"index"`
-	Width       int      `json:"width"`
-	PID         int      `json:"pid"`
-	Height      int      `json:"height"`
-	Active      bool     `json:"active"`
-	ID          string   `json:"id"`
-	Cwd         string   `json:"cwd"`
-	TtyFd       string   `json:"ttyfd"`
-	CurrentMode PaneMode `json:"currentMode"`
+	Index       int      `json:"index" tmux:"pane_index"`
+	Width       int      `json:"width" tmux:"pane_width"`
+	PID         int      `json:"pid" tmux:"pane_pid"`
+	Height      int      `json:"height" tmux:"pane_height"`
+	Left        int      `json:"left" tmux:"pane_left"`
+	Top         int      `json:"top" tmux:"pane_top"`
+	Active      bool     `json:"active" tmux:"pane_active"`
+	ID          string   `json:"id" tmux:"pane_id"`
+	Cwd         string   `json:"cwd" tmux:"pane_current_path"`
+	TtyFd       string   `json:"ttyfd" tmux:"pane_tty"`
+	CurrentMode PaneMode `json:"currentMode" tmux:"pane_mode"`
+	Command     string   `json:"command" tmux:"pane_current_command"`
+	Title       string   `json:"title" tmux:"pane_title"`
+	WindowID    string   `json:"windowId" tmux:"window_id"`
+	WindowIndex int      `json:"windowIndex" tmux:"window_index"`
+	SessionName string   `json:"sessionName" tmux:"session_name"`
 }
 
-var (
-	paneFmtLine      = "\"#{pane_id},#{pane_tty},#{pane_pid},#{pane_index},#{pane_width},#{pane_height},#{pane_active},#{pane_current_path},#{pane_mode}\""
-	paneEmtpyFmtLine = ",,,,,,,,"
-)
-
-func parsePaneLine(line string) (Pane, error) {
-	var pane Pane
-	var err error
-
-	split := strings.Split(line, ",")
-
-	if len(split) != 9 {
-		return Pane{}, fmt.Errorf("lib: parsePaneLine: strings.Split: split: split length != 7: line=%s", line)
-	}
-
-	// ID
-	pane.ID = split[0]
-
-	// tty
-	pane.TtyFd = split[1]
-
-	// index
-	pane.PID, err = strconv.Atoi(split[2])
-	if err != nil {
-		return Pane{}, fmt.Errorf("lib: parsePaneLine: strconv.Atoi: pane.PID: %s", err)
-	}
-
-	// index
-	pane.Index, err = strconv.Atoi(split[3])
-	if err != nil {
-		return Pane{}, fmt.Errorf("lib: parsePaneLine: strconv.Atoi: pane.Index: %s", err)
-	}
-
-	// width
-	pane.Width, err = strconv.Atoi(split[4])
-	if err != nil {
-		return Pane{}, fmt.Errorf("lib: parsePaneLine: strconv.Atoi: pane.Width: %s", err)
+// ListPanes returns the panes in window, a target such as a window ID or
+// WindowTarget(...). An empty window means the current one.
+func ListPanes(window string) ([]Pane, error) {
+	c := Command("list-panes")
+	if window != "" {
+		c.Target(window)
 	}
 
-	// height
-	pane.Height, err = strconv.Atoi(split[5])
+	ret, err := Query[Pane](c)
 	if err != nil {
-		return Pane{}, fmt.Errorf("lib: parsePaneLine: strconv.Atoi: pane.Height: %s", err)
+		return nil, fmt.Errorf("lib: ListPanes: %s", err)
 	}
 
-	pane.Active = split[6] == "1"
-
-	// cwd
-	pane.Cwd = split[7]
-
-	pane.CurrentMode = PaneMode(split[8])
-	return pane, nil
-}
-
-func GetPanes() ([]Pane, error) {
-	if UsePaneCache {
-		return PaneCache, nil
-	}
-
-	UsePaneCache = true
-
-	o, e, err := Tmux(GlobalArgs, "list-panes", map[string]string{
-		"-F": paneFmtLine,
-	}, "")
-	if err != nil {
-		return nil, fmt.Errorf("%s: %s", err.Error(), e)
-	}
-
-	var ret []Pane
-
-	for _, l := range strings.Split(o, "\n") {
-		if l == "" || l == "\n" || l == paneEmtpyFmtLine {
-			continue
-		}
-		pane, err := parsePaneLine(l)
-		if err != nil {
-			return nil, fmt.Errorf("lib: GetPanes: parsePaneLin: pane: err=%s, line=%s", err, l)
-		}
-
-		ret = append(ret, pane)
-	}
-
-	PaneCache = ret
-
 	return ret, nil
 }
 
-func getNeighborDirs(pane Pane) map[string]bool {
-	o, _, err := Tmux(GlobalArgs, "display-message", map[string]string{
-		"-p": "",
-		"-t": pane.ID,
-		"-F": "\"#{pane_at_left},#{pane_at_right},#{pane_at_top},#{pane_at_bottom}\"",
-	}, "")
-	if err != nil {
-		return nil
-	}
-
-	ret := make(map[string]bool, 4)
-
-	split := strings.Split(o, ",")
-
-	ret["left"] = split[0] == "0"
-	ret["right"] = split[1] == "0"
-	ret["top"] = split[2] == "0"
-	ret["bottom"] = split[3] == "0"
-
-	return ret
+type paneEdges struct {
+	AtLeft   bool `tmux:"pane_at_left"`
+	AtRight  bool `tmux:"pane_at_right"`
+	AtTop    bool `tmux:"pane_at_top"`
+	AtBottom bool `tmux:"pane_at_bottom"`
 }
 
+// GetPaneInDir returns the pane next to pane on the dir side ("left",
+// "bottom", "top", "right"), the one sharing the longest stretch of border if
+// there are several. Unlike {left-of} and friends it works from the pane
+// geometry, so focus never moves.
 func GetPaneInDir(pane Pane, dir string) (Pane, bool, error) {
-	currPane, err := GetCurrentPane("")
+	snap, err := NewSnapshot(pane.WindowID)
 	if err != nil {
-		return Pane{}, false, fmt.Errorf("lib: GetPaneInDir: getCurrentPane: ... : %s", err)
-	}
-
-	if currPane.ID != pane.ID {
-		err = SelectPane(pane)
-		if err != nil {
-			return Pane{}, false, fmt.Errorf("lib: GetPaneInDir: SelectPane: ... : %s", err)
-		}
+		return Pane{}, false, fmt.Errorf("lib: GetPaneInDir: %s", err)
 	}
 
-	o, e, err := Tmux(GlobalArgs, "display-message", map[string]string{
-		"-p": fmt.Sprintf("\"#{pane_at_%s}\"", dir),
-	}, "")
+	panes, err := snap.PanesInDir(pane, dir)
 	if err != nil {
-		log.Println(e)
-		return Pane{}, false, fmt.Errorf("lib: GetPaneInDir: Tmux: command failed: %s", err)
+		return Pane{}, false, fmt.Errorf("lib: GetPaneInDir: %s", err)
 	}
 
-	if o == "1" {
+	if len(panes) == 0 {
 		return Pane{}, false, nil
 	}
 
-	var ofDir string
-
-	switch dir {
-	case "left", "right":
-		ofDir = dir
-	case "bottom":
-		ofDir = "down"
-	case "top":
-		ofDir = "up"
-	}
-
-	o, e, err = Tmux(GlobalArgs, "display-message", map[string]string{
-		"-p": "",
-		"-t": fmt.Sprintf("{%s-of}", ofDir),
-		"-F": paneFmtLine,
-	}, "")
-	if err != nil {
-		log.Println(e)
-		return Pane{}, false, fmt.Errorf("lib: GetPaneInDir: Tmux: command failed: %s", err)
-	}
-
-	o = strings.Split(o, "\n")[0]
-
-	if currPane.ID != pane.ID {
-		err = SelectPane(currPane)
-		if err != nil {
-			return Pane{}, false, fmt.Errorf("lib: GetPaneInDir: SelectPane: ... : %s", err)
-		}
-	}
-
-	if o == paneEmtpyFmtLine {
-		return Pane{}, false, nil
-	}
-
-	ret, err := parsePaneLine(o)
-
-	return ret, true, err
+	return panes[0], true, nil
 }
 
 func GetCurrentPane(target string) (Pane, error) {
-	args := map[string]string{
-		"-p": "",
-		"-F": paneFmtLine,
-	}
-
-	if target != "" {
-		args["-t"] = target
-	}
-
-	o, e, err := Tmux(GlobalArgs, "display-message", args, "")
+	ret, err := QueryOne[Pane](target)
 	if err != nil {
-		log.Println(e)
-		return Pane{}, err
+		return Pane{}, fmt.Errorf("lib: GetCurrentPane: %s", err)
 	}
 
-	return parsePaneLine(strings.Split(o, "\n")[0])
+	return ret, nil
 }
 
 func SelectPane(pane Pane) error {
-	_, e, err := Tmux(GlobalArgs, "select-pane", map[string]string{
-		"-t": pane.ID,
-	}, "")
+	_, e, err := Command("select-pane").Target(pane.ID).Run()
 	if err != nil {
 		log.Println(e)
 		return err
@@ -231,10 +96,7 @@ func SelectPane(pane Pane) error {
 }
 
 func SwapPanes(src, dest Pane) error {
-	_, e, err := Tmux(GlobalArgs, "swap-pane", map[string]string{
-		"-s": src.ID,
-		"-t": dest.ID,
-	}, "")
+	_, e, err := Command("swap-pane").Source(src.ID).Target(dest.ID).Run()
 	if err != nil {
 		log.Println(e)
 		return fmt.Errorf("lib: swapPanes: Tmux: command failed: %s", err)
@@ -243,61 +105,13 @@ func SwapPanes(src, dest Pane) error {
 	return nil
 }
 
-// map[dir-select][formatString, query]
-var dirArgs = map[string][]string{
-	"top-left":     {"\"#{pane_at_top},#{pane_at_left}\"", "11"},
-	"top-right":    {"\"#{pane_at_top},#{pane_at_right}\"", "11"},
-	"bottom-left":  {"\"#{pane_at_bottom},#{pane_at_left}\"", "11"},
-	"bottom-right": {"\"#{pane_at_bottom},#{pane_at_right}\"", "11"},
-	"left":         {"\"#{pane_at_left}\"", "1"},
-	"right":        {"\"#{pane_at_right}\"", "1"},
-	"top":          {"\"#{pane_at_top}\"", "1"},
-	"bottom":       {"\"#{pane_at_bottom}\"", "1"},
-}
-
-// GetFurthestPaneInDir - valid args are:
-// top-left,
-// top-right,
-// bottom-left,
-// bottom-right,
-// left,
-// right,
-// top,
-// and bottom
-func GetFurthestPaneInDir(dir string) (Pane, error) {
-	panes, err := GetPanes()
-	if err != nil {
-		return Pane{}, fmt.Errorf("lib: GetFurthestPaneInDir: GetPanes: ...: %s", err)
-	}
-
-	if _, ok := dirArgs[dir]; !ok {
-		return Pane{}, fmt.Errorf("lib: GetFurthestPaneInDir: GetPanes: dirArgs: direction does not exist: %s", dir)
-	}
-
-	for _, p := range panes {
-		o, e, err := Tmux(GlobalArgs, "display-message", map[string]string{
-			"-p": "",
-			"-t": p.ID,
-			"-F": dirArgs[dir][0],
-		}, "")
-		if err != nil {
-			log.Println(e)
-			return Pane{}, err
-		}
-
-		o = strings.Split(o, "\n")[0]
-
-		if o == dirArgs[dir][1] {
-			return p, nil
-		}
-	}
-
-	return Pane{}, fmt.Errorf("could not find furthest %s pane?", dir)
-}
-
 type Neighbor struct {
+	// Pane is the best match on that side, see GetPaneInDir
 	Pane   Pane
 	Exists bool
+
+	// All is every pane on that side, most shared border first
+	All []Pane
 }
 
 type Neighbors struct {
@@ -306,52 +120,16 @@ type Neighbors struct {
 
 // Get neighboring panes ("left", "bottom", "top", "right")
 func GetNeighbors(pane Pane) (Neighbors, error) {
-	ret := Neighbors{}
-
-	ret.Panes = make(map[string]Neighbor)
-
-	for k, v := range getNeighborDirs(pane) {
-		if !v {
-			ret.Panes[k] = Neighbor{
-				Pane:   Pane{},
-				Exists: false,
-			}
-
-			continue
-		}
-
-		// Shadow outer var cause Go~
-		k := k
-
-		p, ok, err := GetPaneInDir(pane, k)
-		if err != nil {
-			return Neighbors{}, fmt.Errorf("%s : %s", k, err)
-		}
-
-		ret.Panes[k] = Neighbor{
-			Pane:   p,
-			Exists: ok,
-		}
-	}
-
-	return ret, nil
-}
-
-// Quick func to get length of panes in current window
-func GetPanesLen() int {
-	panes, err := GetPanes()
+	snap, err := NewSnapshot(pane.WindowID)
 	if err != nil {
-		log.Println(err)
-		return -1
+		return Neighbors{}, fmt.Errorf("lib: GetNeighbors: %s", err)
 	}
 
-	return len(panes)
+	return snap.Neighbors(pane)
 }
 
 func KillPane(pane Pane) error {
-	_, e, err := Tmux(GlobalArgs, "kill-pane", map[string]string{
-		"-t": pane.ID,
-	}, "")
+	_, e, err := Command("kill-pane").Target(pane.ID).Run()
 	if err != nil {
 		log.Println(e)
 		return err
@@ -361,9 +139,7 @@ func KillPane(pane Pane) error {
 }
 
 func FocusPane(pane Pane) error {
-	_, e, err := Tmux(GlobalArgs, "select-pane", map[string]string{
-		"-t": pane.ID,
-	}, "")
+	_, e, err := Command("select-pane").Target(pane.ID).Run()
 	if err != nil {
 		log.Println(e)
 		return err
@@ -375,9 +151,7 @@ func FocusPane(pane Pane) error {
 var vimRx = regexp.MustCompile(`.*vim$`)
 
 func IsVim(pane Pane) bool {
-	o, e, err := Tmux(GlobalArgs, "display-message", map[string]string{
-		"-p": "\"#{pane_current_command}\"",
-	}, "")
+	o, e, err := Command("display-message").Flag("-p").Target(pane.ID).Arg("#{pane_current_command}").Run()
 	if err != nil {
 		log.Println(e)
 		log.Println(err)
@@ -0,0 +1,475 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrNoTerminal is returned by Pick when there's no terminal to ask on
+var ErrNoTerminal = errors.New("lib: Pick: no terminal")
+
+// match is an item that matches the query, and how well
+type match struct {
+	item  string
+	index int
+	score int
+}
+
+// fuzzyScore reports whether every rune of query appears in item in order,
+// and a score that's higher for runs of matching runes, matches at the start
+// of words and shorter items. The query is case sensitive only if it has an
+// upper case letter in it.
+func fuzzyScore(item, query string) (int, bool) {
+	if query == "" {
+		return 0, true
+	}
+
+	fold := !strings.ContainsFunc(query, unicode.IsUpper)
+
+	q := []rune(query)
+	qi := 0
+	score := 0
+	run := 0
+	prev := ' '
+
+	for _, r := range item {
+		if qi == len(q) {
+			break
+		}
+
+		c := r
+		if fold {
+			c = unicode.ToLower(r)
+		}
+
+		if c == q[qi] {
+			qi++
+			run++
+			score += run * 2
+
+			// Start of a word, path component or the item
+			if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+				score += 3
+			}
+		} else {
+			run = 0
+		}
+
+		prev = r
+	}
+
+	if qi < len(q) {
+		return 0, false
+	}
+
+	return score*100 - utf8.RuneCountInString(item), true
+}
+
+// filterItems returns the items matching query, best first
+func filterItems(items []string, query string) []match {
+	var ret []match
+
+	for i, item := range items {
+		if score, ok := fuzzyScore(item, query); ok {
+			ret = append(ret, match{item: item, index: i, score: score})
+		}
+	}
+
+	slices.SortStableFunc(ret, func(a, b match) int {
+		return b.score - a.score
+	})
+
+	return ret
+}
+
+// picker is the state of a Pick on tty
+type picker struct {
+	tty    *os.File
+	items  []string
+	prompt string
+
+	query    []rune
+	matches  []match
+	selected int
+	offset   int
+}
+
+// size is the terminal's width and height, or 80x24 if it won't say
+func (p *picker) size() (int, int) {
+	ws, err := unix.IoctlGetWinsize(int(p.tty.Fd()), unix.TIOCGWINSZ)
+	if err != nil || ws.Col == 0 || ws.Row == 0 {
+		return 80, 24
+	}
+
+	return int(ws.Col), int(ws.Row)
+}
+
+// truncate cuts s to fit in width columns
+func truncate(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+
+	r := []rune(s)
+
+	return string(r[:width-1]) + "…"
+}
+
+func (p *picker) draw() {
+	width, height := p.size()
+
+	// The prompt and count take two lines
+	rows := max(height-2, 1)
+
+	if p.selected < p.offset {
+		p.offset = p.selected
+	}
+
+	if p.selected >= p.offset+rows {
+		p.offset = p.selected - rows + 1
+	}
+
+	var b strings.Builder
+
+	// Home, clear screen
+	b.WriteString("\x1b[H\x1b[2J")
+
+	fmt.Fprintf(&b, "%s\r\n", truncate(p.prompt+string(p.query), width))
+	fmt.Fprintf(&b, "\x1b[2m  %d/%d\x1b[0m", len(p.matches), len(p.items))
+
+	for i := p.offset; i < len(p.matches) && i < p.offset+rows; i++ {
+		line := truncate(p.matches[i].item, width-2)
+
+		if i == p.selected {
+			fmt.Fprintf(&b, "\r\n\x1b[7m> %s\x1b[0m", line)
+		} else {
+			fmt.Fprintf(&b, "\r\n  %s", line)
+		}
+	}
+
+	// Cursor back to the end of the query
+	fmt.Fprintf(&b, "\x1b[1;%dH", min(utf8.RuneCountInString(p.prompt)+len(p.query)+1, width))
+
+	_, _ = p.tty.WriteString(b.String())
+}
+
+func (p *picker) update() {
+	p.matches = filterItems(p.items, string(p.query))
+	p.selected = 0
+	p.offset = 0
+}
+
+func (p *picker) move(n int) {
+	if len(p.matches) == 0 {
+		return
+	}
+
+	p.selected = min(max(p.selected+n, 0), len(p.matches)-1)
+}
+
+// Keys the picker knows, as the terminal sends them
+const (
+	keyCtrlC     = 0x03
+	keyCtrlG     = 0x07
+	keyBackspace = 0x08
+	keyCtrlJ     = 0x0a
+	keyCtrlK     = 0x0b
+	keyEnter     = 0x0d
+	keyCtrlN     = 0x0e
+	keyCtrlP     = 0x10
+	keyCtrlU     = 0x15
+	keyCtrlW     = 0x17
+	keyEsc       = 0x1b
+	keyDelete    = 0x7f
+)
+
+// splitKeys splits one read from the terminal into keys. Keys typed faster
+// than Pick reads them, or pasted, come in together, escape sequences and
+// all.
+func splitKeys(in []byte) [][]byte {
+	var ret [][]byte
+
+	for len(in) > 0 {
+		n := keyLen(in)
+		ret = append(ret, in[:n])
+		in = in[n:]
+	}
+
+	return ret
+}
+
+// keyLen is how many bytes the key at the start of in takes
+func keyLen(in []byte) int {
+	if in[0] != keyEsc {
+		_, n := utf8.DecodeRune(in)
+		return n
+	}
+
+	if len(in) == 1 {
+		return 1
+	}
+
+	switch in[1] {
+	case '[':
+		// Parameters, then a final byte from '@' to '~'
+		for i := 2; i < len(in); i++ {
+			if in[i] >= 0x40 && in[i] <= 0x7e {
+				return i + 1
+			}
+		}
+
+		return len(in)
+	case 'O':
+		return min(3, len(in))
+	case keyEsc:
+		// Esc on its own, then whatever comes next
+		return 1
+	}
+
+	// Alt and a key
+	_, n := utf8.DecodeRune(in[1:])
+
+	return 1 + n
+}
+
+// handle acts on one key from splitKeys. done is true once something was
+// picked (ok) or the picker was cancelled.
+func (p *picker) handle(key []byte) (done, ok bool) {
+	if key[0] == keyEsc {
+		if len(key) == 1 {
+			return true, false
+		}
+
+		// Arrows and page keys: ESC [ A or ESC O A and friends
+		switch strings.TrimLeft(string(key[1:]), "[O") {
+		case "A":
+			p.move(-1)
+		case "B":
+			p.move(1)
+		case "5~":
+			_, height := p.size()
+			p.move(-(height - 2))
+		case "6~":
+			_, height := p.size()
+			p.move(height - 2)
+		}
+
+		return false, false
+	}
+
+	r, _ := utf8.DecodeRune(key)
+
+	switch r {
+	case keyCtrlC, keyCtrlG:
+		return true, false
+	case keyEnter, keyCtrlJ:
+		return true, len(p.matches) > 0
+	case keyCtrlP, keyCtrlK:
+		p.move(-1)
+	case keyCtrlN:
+		p.move(1)
+	case keyBackspace, keyDelete:
+		if len(p.query) > 0 {
+			p.query = p.query[:len(p.query)-1]
+			p.update()
+		}
+	case keyCtrlU:
+		p.query = p.query[:0]
+		p.update()
+	case keyCtrlW:
+		i := len(p.query)
+		for i > 0 && p.query[i-1] == ' ' {
+			i--
+		}
+
+		for i > 0 && p.query[i-1] != ' ' {
+			i--
+		}
+
+		p.query = p.query[:i]
+		p.update()
+	default:
+		if r != utf8.RuneError && unicode.IsPrint(r) {
+			p.query = append(p.query, r)
+			p.update()
+		}
+	}
+
+	return false, false
+}
+
+// PickCommand is the command line of a program that runs Pick on the lines
+// of its stdin, prints the choice and takes a --prompt. Pick runs it in a
+// tmux popup when it has no terminal of its own, like from a run-shell key
+// binding. Without it, Pick returns ErrNoTerminal there.
+var PickCommand []string
+
+// pickInPopup asks with PickCommand in a popup on the current tmux client.
+// The items go in and the choice comes back through temporary files.
+func pickInPopup(items []string, prompt string) (string, error) {
+	if len(PickCommand) == 0 || !Supports(FeaturePopup) {
+		return "", ErrNoTerminal
+	}
+
+	dir, err := os.MkdirTemp("", "tmux-tools-pick")
+	if err != nil {
+		return "", fmt.Errorf("lib: Pick: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "items")
+	out := filepath.Join(dir, "picked")
+
+	err = os.WriteFile(in, []byte(strings.Join(items, "\n")+"\n"), 0600)
+	if err != nil {
+		return "", fmt.Errorf("lib: Pick: %s", err)
+	}
+
+	argv := append(slices.Clone(PickCommand), "--prompt", prompt)
+	shell := fmt.Sprintf("%s < %s > %s", ShellJoin(argv), ShellQuote(in), ShellQuote(out))
+
+	// display-popup waits for the popup to close
+	_, e, err := Command("display-popup").Flag("-E").Opt("-w", "80%").Opt("-h", "60%").Arg(shell).Run()
+	if err != nil {
+		return "", fmt.Errorf("lib: Pick: display-popup: %s: %s", err, e)
+	}
+
+	picked, err := os.ReadFile(out)
+	if err != nil {
+		return "", fmt.Errorf("lib: Pick: %s", err)
+	}
+
+	return strings.TrimSuffix(string(picked), "\n"), nil
+}
+
+// Pick lets the user choose one of items with a small fuzzy finder on the
+// terminal, for when fzf isn't around: type to filter, arrows (or ctrl-p and
+// ctrl-n) to move, Enter to pick and Esc or ctrl-c to give up. Giving up is an
+// empty string and no error.
+//
+// It draws on /dev/tty, so it works with stdin and stdout redirected and
+// inside a tmux popup. With no terminal at all it opens a popup to ask in,
+// see PickCommand.
+func Pick(items []string, prompt string) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return pickInPopup(items, prompt)
+	}
+	defer tty.Close()
+
+	fd := int(tty.Fd())
+
+	old, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return "", ErrNoTerminal
+	}
+
+	raw := *old
+	raw.Iflag &^= unix.ICRNL | unix.IXON
+	raw.Lflag &^= unix.ECHO | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+
+	err = unix.IoctlSetTermios(fd, ioctlSetTermios, &raw)
+	if err != nil {
+		return "", fmt.Errorf("lib: Pick: %s", err)
+	}
+
+	// Alternate screen, so whatever was on the terminal comes back after
+	_, _ = tty.WriteString("\x1b[?1049h")
+
+	defer func() {
+		_, _ = tty.WriteString("\x1b[?1049l")
+		_ = unix.IoctlSetTermios(fd, ioctlSetTermios, old)
+	}()
+
+	p := &picker{
+		tty:    tty,
+		items:  items,
+		prompt: prompt,
+	}
+
+	p.update()
+
+	// Redraw when the terminal (or popup) is resized
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, unix.SIGWINCH)
+	defer signal.Stop(winch)
+
+	keys := make(chan []byte)
+	readErr := make(chan error, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		buf := make([]byte, 256)
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			// Wait in poll rather than Read, so nothing is left reading the
+			// terminal (and eating a key meant for whatever runs next) once
+			// Pick returns
+			n, err := unix.Poll(fds, 100)
+			if err == unix.EINTR || n == 0 {
+				continue
+			}
+
+			if err == nil {
+				n, err = tty.Read(buf)
+			}
+
+			if err != nil {
+				readErr <- err
+				return
+			}
+
+			select {
+			case keys <- slices.Clone(buf[:n]):
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	for {
+		p.draw()
+
+		select {
+		case <-winch:
+		case err := <-readErr:
+			return "", fmt.Errorf("lib: Pick: %s", err)
+		case in := <-keys:
+			for _, key := range splitKeys(in) {
+				done, ok := p.handle(key)
+				if !done {
+					continue
+				}
+
+				if !ok {
+					return "", nil
+				}
+
+				return p.matches[p.selected].item, nil
+			}
+		}
+	}
+}
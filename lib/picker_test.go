@@ -0,0 +1,173 @@
+package lib
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		item, query string
+		ok          bool
+	}{
+		{"anything", "", true},
+		{"tmux-tools", "tt", true},
+		{"tmux-tools", "tmt", true},
+		{"tmux-tools", "ttm", false},
+		// Lower case queries ignore case, others don't
+		{"Notes", "notes", true},
+		{"notes", "Notes", false},
+		{"Notes", "No", true},
+		{"ünïcode", "üï", true},
+		{"short", "shorter", false},
+	}
+
+	for _, tt := range tests {
+		if _, ok := fuzzyScore(tt.item, tt.query); ok != tt.ok {
+			t.Errorf("%q in %q: got %t, want %t", tt.query, tt.item, ok, tt.ok)
+		}
+	}
+
+	// Runs, word starts and shorter items score higher
+	better := [][3]string{
+		{"api", "xaxpxi", "api"},
+		{"api", "rapid", "api"},
+		{"api", "api-server", "api"},
+		{"web-server", "wolves", "ws"},
+	}
+
+	for _, b := range better {
+		hi, _ := fuzzyScore(b[0], b[2])
+		lo, _ := fuzzyScore(b[1], b[2])
+
+		if hi <= lo {
+			t.Errorf("%q: %q scored %d, not more than %q with %d", b[2], b[0], hi, b[1], lo)
+		}
+	}
+}
+
+func TestFilterItems(t *testing.T) {
+	items := []string{"web-server", "wolves", "api", "ws", "docs"}
+
+	var got []string
+	for _, m := range filterItems(items, "ws") {
+		got = append(got, m.item)
+	}
+
+	// Two word starts beat a run of two
+	if want := []string{"web-server", "ws", "wolves"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// No query keeps everything in order
+	all := filterItems(items, "")
+	for i, m := range all {
+		if m.item != items[i] || m.index != i {
+			t.Errorf("%d: got %+v", i, m)
+		}
+	}
+}
+
+func TestSplitKeys(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"ab", []string{"a", "b"}},
+		{"é\r", []string{"é", "\r"}},
+		{"\x1b", []string{"\x1b"}},
+		{"\x1b[A\x1b[B", []string{"\x1b[A", "\x1b[B"}},
+		{"\x1bOA\x1b[6~x", []string{"\x1bOA", "\x1b[6~", "x"}},
+		{"\x1b\x1b[A", []string{"\x1b", "\x1b[A"}},
+		{"\x1bx", []string{"\x1bx"}},
+		{"\x1b[1;5", []string{"\x1b[1;5"}},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, k := range splitKeys([]byte(tt.in)) {
+			got = append(got, string(k))
+		}
+
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// feed sends in to p a key at a time, the way Pick does with a read
+func feed(p *picker, in string) (done, ok bool) {
+	for _, key := range splitKeys([]byte(in)) {
+		done, ok = p.handle(key)
+		if done {
+			return done, ok
+		}
+	}
+
+	return false, false
+}
+
+func TestPickerHandle(t *testing.T) {
+	items := []string{"alpha", "beta", "gamma", "delta"}
+
+	tests := []struct {
+		name  string
+		in    string
+		done  bool
+		ok    bool
+		query string
+		item  string
+	}{
+		{name: "enter picks the first", in: "\r", done: true, ok: true, item: "alpha"},
+		{name: "typing filters", in: "gm", query: "gm", item: "gamma"},
+		{name: "down and up in one read", in: "\x1b[B\x1b[B\x1b[A\r", done: true, ok: true, item: "beta"},
+		{name: "ctrl-n and ctrl-p", in: "\x0e\x0e\x0e\x10", item: "gamma"},
+		{name: "down stops at the end", in: "\x1b[6~\x1b[B", item: "delta"},
+		{name: "backspace", in: "ab\x7f", query: "a", item: "alpha"},
+		{name: "ctrl-w drops the last word", in: "ph\x17al", query: "al", item: "alpha"},
+		{name: "ctrl-u", in: "xyz\x15", item: "alpha"},
+		{name: "nothing matches", in: "zz\r", done: true, ok: false, query: "zz"},
+		{name: "esc", in: "al\x1b", done: true, ok: false, query: "al", item: "alpha"},
+		{name: "ctrl-c", in: "\x03", done: true, ok: false, item: "alpha"},
+		{name: "arrow isn't esc", in: "\x1bOB", item: "beta"},
+		{name: "keys after enter are left alone", in: "\rzz", done: true, ok: true, item: "alpha"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &picker{items: items}
+			p.update()
+
+			done, ok := feed(p, tt.in)
+
+			if done != tt.done || ok != tt.ok {
+				t.Errorf("got done=%t ok=%t, want done=%t ok=%t", done, ok, tt.done, tt.ok)
+			}
+
+			if string(p.query) != tt.query {
+				t.Errorf("query %q, want %q", string(p.query), tt.query)
+			}
+
+			var item string
+			if len(p.matches) > 0 {
+				item = p.matches[p.selected].item
+			}
+
+			if item != tt.item {
+				t.Errorf("selected %q, want %q", item, tt.item)
+			}
+		})
+	}
+}
+
+func TestPickInPopupWithoutCommand(t *testing.T) {
+	old := PickCommand
+	PickCommand = nil
+	t.Cleanup(func() { PickCommand = old })
+
+	_, err := pickInPopup([]string{"a"}, "> ")
+	if !errors.Is(err, ErrNoTerminal) {
+		t.Errorf("got %v, want ErrNoTerminal", err)
+	}
+}
@@ -0,0 +1,7 @@
+package lib
+
+import "errors"
+
+// ErrProcUnsupported is returned by GetProcArgv where there's no /proc to
+// read. GetProcCmd still works there.
+var ErrProcUnsupported = errors.New("lib: reading process arguments isn't supported on this system")
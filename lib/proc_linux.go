@@ -0,0 +1,185 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// procStat is the part of /proc/<pid>/stat we care about
+type procStat struct {
+	ppid  int
+	pgrp  int
+	tpgid int
+}
+
+func readProcStat(pid int) (procStat, error) {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return procStat{}, err
+	}
+
+	// The command name is in parens and can hold anything, including
+	// spaces and parens, so go from the last ')'
+	s := string(b)
+	end := strings.LastIndexByte(s, ')')
+	if end < 0 {
+		return procStat{}, fmt.Errorf("/proc/%d/stat: no command name", pid)
+	}
+
+	// state ppid pgrp session tty_nr tpgid ...
+	fields := strings.Fields(s[end+1:])
+	if len(fields) < 6 {
+		return procStat{}, fmt.Errorf("/proc/%d/stat: too short", pid)
+	}
+
+	var ret procStat
+
+	for i, dst := range map[int]*int{1: &ret.ppid, 2: &ret.pgrp, 5: &ret.tpgid} {
+		*dst, err = strconv.Atoi(fields[i])
+		if err != nil {
+			return procStat{}, fmt.Errorf("/proc/%d/stat: %s", pid, err)
+		}
+	}
+
+	return ret, nil
+}
+
+// procChildren lists pid's children from /proc/<pid>/task/*/children, or by
+// scanning every process on kernels built without that file
+func procChildren(pid int) ([]int, error) {
+	tasks, err := filepath.Glob(fmt.Sprintf("/proc/%d/task/*/children", pid))
+	if err == nil && len(tasks) > 0 {
+		var ret []int
+
+		for _, t := range tasks {
+			b, err := os.ReadFile(t)
+			if err != nil {
+				continue
+			}
+
+			for f := range strings.FieldsSeq(string(b)) {
+				if child, err := strconv.Atoi(f); err == nil {
+					ret = append(ret, child)
+				}
+			}
+		}
+
+		return ret, nil
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []int
+
+	for _, e := range entries {
+		child, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+
+		if st, err := readProcStat(child); err == nil && st.ppid == pid {
+			ret = append(ret, child)
+		}
+	}
+
+	return ret, nil
+}
+
+func readCmdline(pid int) ([]string, error) {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	b = []byte(strings.TrimSuffix(string(b), "\x00"))
+	if len(b) == 0 {
+		return nil, fmt.Errorf("/proc/%d/cmdline: empty", pid)
+	}
+
+	return strings.Split(string(b), "\x00"), nil
+}
+
+// GetProcArgv returns the argv of whatever is in the foreground on the
+// terminal of pid, a pane's shell (#{pane_pid}). That's the leader of the
+// tty's foreground process group, so `vim a | less` gives vim and a
+// backgrounded job doesn't count. It's nil when the shell itself is in the
+// foreground.
+func GetProcArgv(pid int) ([]string, error) {
+	shell, err := readProcStat(pid)
+	if err != nil {
+		return nil, fmt.Errorf("lib: GetProcArgv: %s", err)
+	}
+
+	// tpgid is the foreground group of the process' controlling terminal,
+	// which for a pane's shell is the pane
+	if shell.tpgid <= 0 || shell.tpgid == shell.pgrp {
+		return nil, nil
+	}
+
+	// Only look under the pane's shell so we never pick up something
+	// else that happens to share the number
+	var leader, member int
+
+	queue := []int{pid}
+	seen := map[int]bool{pid: true}
+
+	for len(queue) > 0 && leader == 0 {
+		children, err := procChildren(queue[0])
+		queue = queue[1:]
+
+		if err != nil {
+			continue
+		}
+
+		for _, c := range children {
+			if seen[c] {
+				continue
+			}
+			seen[c] = true
+
+			st, err := readProcStat(c)
+			if err != nil {
+				continue
+			}
+
+			if c == shell.tpgid {
+				leader = c
+				break
+			}
+
+			if member == 0 && st.pgrp == shell.tpgid {
+				member = c
+			}
+
+			queue = append(queue, c)
+		}
+	}
+
+	// The leader of a pipeline can exit before the rest of it
+	if leader == 0 {
+		leader = member
+	}
+
+	if leader == 0 {
+		return nil, nil
+	}
+
+	argv, err := readCmdline(leader)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// Exited while we looked
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("lib: GetProcArgv: %s", err)
+	}
+
+	return argv, nil
+}
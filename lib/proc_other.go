@@ -0,0 +1,8 @@
+//go:build !linux
+
+package lib
+
+// GetProcArgv needs /proc, see proc_linux.go
+func GetProcArgv(pid int) ([]string, error) {
+	return nil, ErrProcUnsupported
+}
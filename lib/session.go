@@ -0,0 +1,48 @@
+package lib
+
+import "fmt"
+
+// Session is a tmux session
+type Session struct {
+	ID   string `json:"id" tmux:"session_id"`
+	Name string `json:"name" tmux:"session_name"`
+	Path string `json:"path" tmux:"session_path"`
+	// Attached counts control mode clients too, see AttachedSessions
+	Attached     int   `json:"attached" tmux:"session_attached"`
+	Windows      int   `json:"windows" tmux:"session_windows"`
+	Created      int64 `json:"created" tmux:"session_created"`
+	LastAttached int64 `json:"lastAttached" tmux:"session_last_attached"`
+}
+
+// ListSessions returns every session on the server
+func ListSessions() ([]Session, error) {
+	ret, err := Query[Session](Command("list-sessions"))
+	if err != nil {
+		return nil, fmt.Errorf("lib: ListSessions: %s", err)
+	}
+
+	return ret, nil
+}
+
+// GetSession returns the session at target, or the current session if
+// target is empty
+func GetSession(target string) (Session, error) {
+	ret, err := QueryOne[Session](target)
+	if err != nil {
+		return Session{}, fmt.Errorf("lib: GetSession: %s", err)
+	}
+
+	return ret, nil
+}
+
+// Target returns a target for the session
+func (s Session) Target() string {
+	return s.ID
+}
+
+// HasSession reports whether a session called name exists
+func HasSession(name string) bool {
+	_, _, err := Command("has-session").Target(SessionTarget(name)).Run()
+
+	return err == nil
+}
@@ -0,0 +1,407 @@
+package lib
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/distek/tmux-tools/lib/layout"
+)
+
+// generation goes up every time a command that can move, add or remove panes
+// runs. Snapshots taken at an older generation are stale.
+var generation atomic.Uint64
+
+// mutating is every command (and alias) that changes pane geometry, pane
+// membership of a window or the active pane
+var mutating = map[string]bool{
+	"break-pane": true, "breakp": true,
+	"join-pane": true, "joinp": true,
+	"kill-pane": true, "killp": true,
+	"kill-window": true, "killw": true,
+	"move-pane": true, "movep": true,
+	"new-window": true, "neww": true,
+	"resize-pane": true, "resizep": true,
+	"resize-window": true, "resizew": true,
+	"respawn-pane": true, "respawnp": true,
+	"rotate-window": true, "rotatew": true,
+	"select-layout": true, "selectl": true,
+	"select-pane": true, "selectp": true,
+	"split-window": true, "splitw": true,
+	"swap-pane": true, "swapp": true,
+}
+
+func invalidate(c *Cmd) {
+	if mutating[c.name] {
+		generation.Add(1)
+	}
+}
+
+// snapshotPane is what a Snapshot asks tmux for about each pane
+type snapshotPane struct {
+	Pane
+	paneEdges
+
+	WindowWidth  int    `tmux:"window_width"`
+	WindowHeight int    `tmux:"window_height"`
+	WindowLayout string `tmux:"window_layout"`
+}
+
+// Snapshot is the panes of one window at one point in time. It's fetched
+// lazily and fetched again the next time it's used after anything in lib
+// (SwapPanes, KillPane, a split, ...) has changed the layout, so it's safe to
+// hold on to one across several operations.
+type Snapshot struct {
+	mu     sync.Mutex
+	window string
+	gen    uint64
+	valid  bool
+	panes  []snapshotPane
+}
+
+// NewSnapshot takes a snapshot of window, a target such as a window ID or
+// WindowTarget(...). An empty window means the current one; the snapshot
+// sticks to that window even if the current window changes later.
+func NewSnapshot(window string) (*Snapshot, error) {
+	s := &Snapshot{window: window}
+
+	err := s.refresh()
+	if err != nil {
+		return nil, fmt.Errorf("lib: NewSnapshot: %s", err)
+	}
+
+	return s, nil
+}
+
+// refresh re-queries the window if anything has changed since the last query.
+// s.mu must be held.
+func (s *Snapshot) refresh() error {
+	gen := generation.Load()
+	if s.valid && s.gen == gen {
+		return nil
+	}
+
+	c := Command("list-panes")
+	if s.window != "" {
+		c.Target(s.window)
+	}
+
+	panes, err := Query[snapshotPane](c)
+	if err != nil {
+		return err
+	}
+
+	if len(panes) == 0 {
+		return fmt.Errorf("%s: no panes", s.window)
+	}
+
+	s.window = panes[0].WindowID
+	s.panes = panes
+	s.gen = gen
+	s.valid = true
+
+	return nil
+}
+
+// Stale reports whether the window has been changed since the snapshot was
+// last fetched
+func (s *Snapshot) Stale() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return !s.valid || s.gen != generation.Load()
+}
+
+// Window is the ID of the window the snapshot is of
+func (s *Snapshot) Window() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.window
+}
+
+// Panes returns the panes in the window in index order
+func (s *Snapshot) Panes() ([]Pane, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.refresh()
+	if err != nil {
+		return nil, fmt.Errorf("lib: Snapshot.Panes: %s", err)
+	}
+
+	ret := make([]Pane, len(s.panes))
+	for i, p := range s.panes {
+		ret[i] = p.Pane
+	}
+
+	return ret, nil
+}
+
+// Len returns the number of panes in the window
+func (s *Snapshot) Len() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.refresh()
+	if err != nil {
+		return 0, fmt.Errorf("lib: Snapshot.Len: %s", err)
+	}
+
+	return len(s.panes), nil
+}
+
+// Size returns the width and height of the window
+func (s *Snapshot) Size() (int, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.refresh()
+	if err != nil {
+		return 0, 0, fmt.Errorf("lib: Snapshot.Size: %s", err)
+	}
+
+	return s.panes[0].WindowWidth, s.panes[0].WindowHeight, nil
+}
+
+// Layout returns the window's layout as a tree
+func (s *Snapshot) Layout() (*layout.Cell, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.refresh()
+	if err != nil {
+		return nil, fmt.Errorf("lib: Snapshot.Layout: %s", err)
+	}
+
+	l, err := layout.Parse(s.panes[0].WindowLayout)
+	if err != nil {
+		return nil, fmt.Errorf("lib: Snapshot.Layout: %s", err)
+	}
+
+	return l, nil
+}
+
+// Pane returns the pane with id in the window
+func (s *Snapshot) Pane(id string) (Pane, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.refresh()
+	if err != nil {
+		return Pane{}, false, fmt.Errorf("lib: Snapshot.Pane: %s", err)
+	}
+
+	for _, p := range s.panes {
+		if p.ID == id {
+			return p.Pane, true, nil
+		}
+	}
+
+	return Pane{}, false, nil
+}
+
+// Active returns the window's active pane
+func (s *Snapshot) Active() (Pane, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.refresh()
+	if err != nil {
+		return Pane{}, fmt.Errorf("lib: Snapshot.Active: %s", err)
+	}
+
+	for _, p := range s.panes {
+		if p.Active {
+			return p.Pane, nil
+		}
+	}
+
+	return Pane{}, fmt.Errorf("lib: Snapshot.Active: %s: no active pane", s.window)
+}
+
+// atEdges reports whether p sits on every edge in edges ("top", "left", ...)
+func (p snapshotPane) atEdges(edges ...string) bool {
+	for _, e := range edges {
+		var at bool
+
+		switch e {
+		case "top":
+			at = p.AtTop
+		case "bottom":
+			at = p.AtBottom
+		case "left":
+			at = p.AtLeft
+		case "right":
+			at = p.AtRight
+		}
+
+		if !at {
+			return false
+		}
+	}
+
+	return true
+}
+
+// furthestDirs is the edges each GetFurthestPaneInDir direction has to touch
+var furthestDirs = map[string][]string{
+	"top-left":     {"top", "left"},
+	"top-right":    {"top", "right"},
+	"bottom-left":  {"bottom", "left"},
+	"bottom-right": {"bottom", "right"},
+	"left":         {"left"},
+	"right":        {"right"},
+	"top":          {"top"},
+	"bottom":       {"bottom"},
+}
+
+// FurthestPaneInDir returns the first pane (by index) touching the dir edge
+// of the window. Valid dirs are:
+// top-left,
+// top-right,
+// bottom-left,
+// bottom-right,
+// left,
+// right,
+// top,
+// and bottom
+func (s *Snapshot) FurthestPaneInDir(dir string) (Pane, error) {
+	edges, ok := furthestDirs[dir]
+	if !ok {
+		return Pane{}, fmt.Errorf("lib: FurthestPaneInDir: direction does not exist: %s", dir)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.refresh()
+	if err != nil {
+		return Pane{}, fmt.Errorf("lib: FurthestPaneInDir: %s", err)
+	}
+
+	for _, p := range s.panes {
+		if p.atEdges(edges...) {
+			return p.Pane, nil
+		}
+	}
+
+	return Pane{}, fmt.Errorf("could not find furthest %s pane?", dir)
+}
+
+// overlap is how many cells of border a and b share along one axis, given
+// each one's start and length
+func overlap(aStart, aLen, bStart, bLen int) int {
+	return min(aStart+aLen, bStart+bLen) - max(aStart, bStart)
+}
+
+// PanesInDir returns every pane touching pane's dir side ("left", "bottom",
+// "top", "right"), the ones sharing the most border first. Ties go to the
+// pane nearer the top or left.
+func (s *Snapshot) PanesInDir(pane Pane, dir string) ([]Pane, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.refresh()
+	if err != nil {
+		return nil, fmt.Errorf("lib: PanesInDir: %s", err)
+	}
+
+	// The caller's copy of pane may be older than the snapshot
+	for _, p := range s.panes {
+		if p.ID == pane.ID {
+			pane = p.Pane
+			break
+		}
+	}
+
+	type candidate struct {
+		pane    Pane
+		overlap int
+		pos     int
+	}
+
+	var found []candidate
+
+	for _, sp := range s.panes {
+		p := sp.Pane
+		if p.ID == pane.ID {
+			continue
+		}
+
+		// Panes are separated by a one cell border
+		var adjacent bool
+
+		switch dir {
+		case "left":
+			adjacent = p.Left+p.Width+1 == pane.Left
+		case "right":
+			adjacent = pane.Left+pane.Width+1 == p.Left
+		case "top":
+			adjacent = p.Top+p.Height+1 == pane.Top
+		case "bottom":
+			adjacent = pane.Top+pane.Height+1 == p.Top
+		default:
+			return nil, fmt.Errorf("lib: PanesInDir: direction does not exist: %s", dir)
+		}
+
+		if !adjacent {
+			continue
+		}
+
+		c := candidate{pane: p}
+
+		switch dir {
+		case "left", "right":
+			c.overlap = overlap(pane.Top, pane.Height, p.Top, p.Height)
+			c.pos = p.Top
+		case "top", "bottom":
+			c.overlap = overlap(pane.Left, pane.Width, p.Left, p.Width)
+			c.pos = p.Left
+		}
+
+		if c.overlap <= 0 {
+			continue
+		}
+
+		found = append(found, c)
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].overlap != found[j].overlap {
+			return found[i].overlap > found[j].overlap
+		}
+
+		return found[i].pos < found[j].pos
+	})
+
+	ret := make([]Pane, len(found))
+	for i, c := range found {
+		ret[i] = c.pane
+	}
+
+	return ret, nil
+}
+
+// Neighbors returns the panes on every side of pane
+func (s *Snapshot) Neighbors(pane Pane) (Neighbors, error) {
+	ret := Neighbors{Panes: make(map[string]Neighbor)}
+
+	for _, dir := range []string{"left", "bottom", "top", "right"} {
+		panes, err := s.PanesInDir(pane, dir)
+		if err != nil {
+			return Neighbors{}, fmt.Errorf("lib: Neighbors: %s", err)
+		}
+
+		n := Neighbor{All: panes}
+		if len(panes) != 0 {
+			n.Pane = panes[0]
+			n.Exists = true
+		}
+
+		ret.Panes[dir] = n
+	}
+
+	return ret, nil
+}
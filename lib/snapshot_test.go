@@ -0,0 +1,139 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+)
+
+// fixedSnapshot is a snapshot of an 80x24 window that never asks tmux:
+//
+//	+--------+--------+
+//	|   %0   |   %1   |
+//	|        +----+---+
+//	+--------+ %2 |%3 |
+//	|   %4   |    |   |
+//	+--------+----+---+
+func fixedSnapshot(t *testing.T) *Snapshot {
+	t.Helper()
+
+	old := SetRunner(runnerFunc(func(c *Cmd) (string, string, error) {
+		t.Fatalf("ran %v", c.Args())
+		return "", "", nil
+	}))
+	t.Cleanup(func() { SetRunner(old) })
+
+	pane := func(id string, left, top, width, height int) snapshotPane {
+		return snapshotPane{
+			Pane: Pane{ID: id, Left: left, Top: top, Width: width, Height: height, WindowID: "@1"},
+
+			WindowWidth:  80,
+			WindowHeight: 24,
+		}
+	}
+
+	return &Snapshot{
+		window: "@1",
+		gen:    generation.Load(),
+		valid:  true,
+		panes: []snapshotPane{
+			pane("%0", 0, 0, 40, 11),
+			pane("%1", 41, 0, 39, 7),
+			pane("%2", 41, 8, 19, 16),
+			pane("%3", 61, 8, 19, 16),
+			pane("%4", 0, 12, 40, 12),
+		},
+	}
+}
+
+// ids is the pane IDs of panes
+func ids(panes []Pane) []string {
+	ret := make([]string, len(panes))
+	for i, p := range panes {
+		ret[i] = p.ID
+	}
+
+	return ret
+}
+
+func TestPanesInDir(t *testing.T) {
+	s := fixedSnapshot(t)
+
+	tests := []struct {
+		pane string
+		dir  string
+		want []string
+	}{
+		// %1 shares 7 rows with %0, %2 only 3
+		{"%0", "right", []string{"%1", "%2"}},
+		{"%0", "bottom", []string{"%4"}},
+		{"%0", "left", []string{}},
+		{"%0", "top", []string{}},
+		// %4 is next to %1's left side too, but only past its bottom
+		{"%1", "left", []string{"%0"}},
+		// A tie, so the one further left comes first
+		{"%1", "bottom", []string{"%2", "%3"}},
+		{"%1", "right", []string{}},
+		// More shared border beats being nearer the top
+		{"%2", "left", []string{"%4", "%0"}},
+		{"%2", "right", []string{"%3"}},
+		{"%2", "top", []string{"%1"}},
+		{"%2", "bottom", []string{}},
+		{"%3", "left", []string{"%2"}},
+		{"%3", "top", []string{"%1"}},
+		{"%4", "top", []string{"%0"}},
+		{"%4", "right", []string{"%2"}},
+	}
+
+	for _, tt := range tests {
+		// Only the ID matters, the rest comes from the snapshot
+		got, err := s.PanesInDir(Pane{ID: tt.pane}, tt.dir)
+		if err != nil {
+			t.Errorf("%s %s: %s", tt.pane, tt.dir, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(ids(got), tt.want) {
+			t.Errorf("%s %s: got %v, want %v", tt.pane, tt.dir, ids(got), tt.want)
+		}
+	}
+
+	if _, err := s.PanesInDir(Pane{ID: "%0"}, "up"); err == nil {
+		t.Error("no error for a bad direction")
+	}
+}
+
+func TestNeighbors(t *testing.T) {
+	s := fixedSnapshot(t)
+
+	n, err := s.Neighbors(Pane{ID: "%2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"left":   {"%4", "%0"},
+		"right":  {"%3"},
+		"top":    {"%1"},
+		"bottom": {},
+	}
+
+	for dir, panes := range want {
+		got, ok := n.Panes[dir]
+		if !ok {
+			t.Errorf("%s: missing", dir)
+			continue
+		}
+
+		if !reflect.DeepEqual(ids(got.All), panes) {
+			t.Errorf("%s: got %v, want %v", dir, ids(got.All), panes)
+		}
+
+		if got.Exists != (len(panes) > 0) {
+			t.Errorf("%s: exists %t", dir, got.Exists)
+		}
+
+		if got.Exists && got.Pane.ID != panes[0] {
+			t.Errorf("%s: got %s first, want %s", dir, got.Pane.ID, panes[0])
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package lib
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Cmd is a single tmux command built up as an argv. Flags and positional args
+// keep the order they were added in, so the same Cmd always produces the same
+// command line. Nothing is ever passed through a shell.
+type Cmd struct {
+	name   string
+	flags  []string
+	args   []string
+	global []string
+
+	// globalSet is true when Socket/ConfigFile replaced GlobalArgs
+	globalSet bool
+}
+
+// Command starts a new tmux command (e.g. "list-panes") that runs against the
+// server described by GlobalArgs
+func Command(name string) *Cmd {
+	return &Cmd{name: name}
+}
+
+// Flag adds one or more valueless flags such as "-d" or "-p"
+func (c *Cmd) Flag(flags ...string) *Cmd {
+	c.flags = append(c.flags, flags...)
+	return c
+}
+
+// Opt adds a flag that takes a value such as "-n name"
+func (c *Cmd) Opt(flag, value string) *Cmd {
+	c.flags = append(c.flags, flag, value)
+	return c
+}
+
+// Target adds -t
+func (c *Cmd) Target(target string) *Cmd {
+	return c.Opt("-t", target)
+}
+
+// Source adds -s
+func (c *Cmd) Source(source string) *Cmd {
+	return c.Opt("-s", source)
+}
+
+// Format adds -F
+func (c *Cmd) Format(format string) *Cmd {
+	return c.Opt("-F", format)
+}
+
+// StartDir adds -c
+func (c *Cmd) StartDir(dir string) *Cmd {
+	return c.Opt("-c", dir)
+}
+
+// Arg adds positional arguments. They always come after every flag.
+func (c *Cmd) Arg(args ...string) *Cmd {
+	c.args = append(c.args, args...)
+	return c
+}
+
+// Socket runs the command against the server at path instead of the one in
+// GlobalArgs
+func (c *Cmd) Socket(path string) *Cmd {
+	c.globalSet = true
+	c.global = append(c.global, "-S", path)
+	return c
+}
+
+// ConfigFile adds the global -f flag. Only useful when the command starts a
+// server.
+func (c *Cmd) ConfigFile(path string) *Cmd {
+	c.globalSet = true
+	c.global = append(c.global, "-f", path)
+	return c
+}
+
+// Name is the tmux command name, e.g. "split-window"
+func (c *Cmd) Name() string {
+	return c.name
+}
+
+// Args returns the flags followed by the positional args, without the
+// command name or global args
+func (c *Cmd) Args() []string {
+	ret := make([]string, 0, len(c.flags)+len(c.args))
+	ret = append(ret, c.flags...)
+	return append(ret, c.args...)
+}
+
+// Argv returns everything that follows "tmux" on the command line
+func (c *Cmd) Argv() []string {
+	var ret []string
+
+	if c.globalSet {
+		ret = append(ret, c.global...)
+	} else {
+		ret = append(ret, globalArgv()...)
+	}
+
+	ret = append(ret, c.name)
+
+	return append(ret, c.Args()...)
+}
+
+// Run executes the command and returns its stdout and stderr with the
+// trailing newline removed. Commands on the GlobalArgs server go through the
+// Runner set with SetRunner.
+func (c *Cmd) Run() (string, string, error) {
+	defer invalidate(c)
+
+	if c.globalSet {
+		return c.runExec()
+	}
+
+	return runner.Run(c)
+}
+
+func (c *Cmd) runExec() (string, string, error) {
+	// Without -u a client outside tmux with a C or POSIX locale isn't
+	// UTF-8 to tmux, and it replaces the format separators in the output
+	// with '_'
+	ex := exec.Command("tmux", append([]string{"-u"}, c.Argv()...)...)
+
+	outBuf := bytes.NewBuffer([]byte{})
+	errBuf := bytes.NewBuffer([]byte{})
+
+	ex.Stdout = outBuf
+	ex.Stderr = errBuf
+
+	err := ex.Run()
+
+	return strings.TrimSuffix(outBuf.String(), "\n"), strings.TrimSuffix(errBuf.String(), "\n"), err
+}
+
+// Exec runs the command hooked up to this process' terminal. Use it for
+// commands that take over the tty, like attach-session.
+func (c *Cmd) Exec() error {
+	ex := exec.Command("tmux", c.Argv()...)
+	ex.Stdin = os.Stdin
+	ex.Stdout = os.Stdout
+	ex.Stderr = os.Stderr
+
+	return ex.Run()
+}
+
+// String returns the command (without global args) the way tmux's own
+// command parser reads it, for sending over a control mode connection
+func (c *Cmd) String() string {
+	var bld strings.Builder
+
+	bld.WriteString(c.name)
+
+	for _, a := range c.Args() {
+		bld.WriteString(" ")
+		bld.WriteString(tmuxQuote(a))
+	}
+
+	return bld.String()
+}
+
+// tmuxQuote quotes s for tmux's command parser. Single quotes keep
+// everything literal but can't hold a newline, so those fall back to double
+// quotes with escapes.
+func tmuxQuote(s string) string {
+	if !strings.Contains(s, "\n") {
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	}
+
+	return `"` + strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		`$`, `\$`,
+		"\n", `\n`,
+	).Replace(s) + `"`
+}
+
+// Order global args are emitted in. Anything else in GlobalArgs follows,
+// sorted.
+var globalArgsOrder = []string{"-L", "-S", "-f"}
+
+func globalArgv() []string {
+	var ret []string
+
+	seen := make(map[string]bool, len(GlobalArgs))
+
+	add := func(k string) {
+		v, ok := GlobalArgs[k]
+		if !ok || seen[k] {
+			return
+		}
+
+		seen[k] = true
+		ret = append(ret, k)
+		if v != "" {
+			ret = append(ret, v)
+		}
+	}
+
+	for _, k := range globalArgsOrder {
+		add(k)
+	}
+
+	var rest []string
+	for k := range GlobalArgs {
+		if !seen[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+
+	for _, k := range rest {
+		add(k)
+	}
+
+	return ret
+}
+
+// SessionTarget returns an exact-match target for the session called name.
+// tmux swaps ':' and '.' for '_' in session names, so the same is done here.
+func SessionTarget(name string) string {
+	return "=" + SessionName(name)
+}
+
+// ActiveTarget returns a target for the current window of the session called
+// name, or that window's active pane. A bare SessionTarget only works for
+// commands that take a session.
+func ActiveTarget(name string) string {
+	return SessionTarget(name) + ":"
+}
+
+// SessionName returns name the way tmux will store it
+func SessionName(name string) string {
+	return strings.NewReplacer(":", "_", ".", "_").Replace(name)
+}
+
+// WindowTarget returns a target for the window at index idx in session
+func WindowTarget(session string, idx int) string {
+	return SessionTarget(session) + ":" + strconv.Itoa(idx)
+}
+
+// PaneTarget returns a target for the pane at index idx in window, where
+// window is a target such as the one from WindowTarget
+func PaneTarget(window string, idx int) string {
+	return window + "." + strconv.Itoa(idx)
+}
+
+// ShellQuote quotes s so a POSIX shell reads it back as a single word. Use it
+// when a string ends up in a shell-command, e.g. for popup.
+func ShellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellSafe is true for bytes that never need quoting in a shell word
+func shellSafe(b byte) bool {
+	switch {
+	case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9':
+		return true
+	}
+
+	return strings.IndexByte("@%+=:,./_-", b) >= 0
+}
+
+// ShellJoin turns argv back into a command line a POSIX shell splits into the
+// same words. Plain words are left alone so it still reads like what was
+// typed.
+func ShellJoin(argv []string) string {
+	words := make([]string, len(argv))
+
+	for i, a := range argv {
+		safe := a != ""
+		for j := 0; j < len(a) && safe; j++ {
+			safe = shellSafe(a[j])
+		}
+
+		if safe {
+			words[i] = a
+		} else {
+			words[i] = ShellQuote(a)
+		}
+	}
+
+	return strings.Join(words, " ")
+}
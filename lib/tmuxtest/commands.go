@@ -0,0 +1,928 @@
+package tmuxtest
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/distek/tmux-tools/lib/layout"
+)
+
+const (
+	defaultPaneFormat    = "#{pane_index}: [#{pane_width}x#{pane_height}] #{pane_id}"
+	defaultWindowFormat  = "#{window_index}: #{window_name} (#{window_panes} panes) [#{window_width}x#{window_height}]"
+	defaultSessionFormat = "#{session_name}: #{session_windows} windows"
+	defaultClientFormat  = "#{client_name}: #{session_name}"
+)
+
+func (s *Server) run(name string, argv []string) (string, error) {
+	if full, ok := aliases[name]; ok {
+		name = full
+	}
+
+	if _, ok := specs[name]; !ok {
+		return "", fmt.Errorf("unknown command: %s", name)
+	}
+
+	a, err := parseArgs(name, argv)
+	if err != nil {
+		return "", err
+	}
+
+	switch name {
+	case "new-session":
+		return s.cmdNewSession(a)
+	case "new-window":
+		return s.cmdNewWindow(a)
+	case "split-window":
+		return s.cmdSplitWindow(a)
+	case "join-pane":
+		return "", s.cmdJoinPane(a)
+	case "swap-pane":
+		return "", s.cmdSwapPane(a)
+	case "kill-pane":
+		return "", s.cmdKillPane(a)
+	case "kill-window":
+		_, w, _, err := s.resolve(a.get('t'))
+		if err != nil {
+			return "", err
+		}
+
+		s.killWindow(w)
+	case "kill-session":
+		sess, err := s.findSession(a.get('t'))
+		if err != nil {
+			return "", err
+		}
+
+		s.killSession(sess)
+	case "kill-server":
+		s.sessions = nil
+		s.current = nil
+	case "has-session":
+		_, err := s.findSession(a.get('t'))
+		return "", err
+	case "last-pane":
+		_, w, _, err := s.resolve(a.get('t'))
+		if err != nil {
+			return "", err
+		}
+
+		if w.last == nil {
+			return "", fmt.Errorf("no last pane")
+		}
+
+		w.active, w.last = w.last, w.active
+	case "select-pane":
+		return "", s.cmdSelectPane(a)
+	case "select-window":
+		sess, w, _, err := s.resolve(a.get('t'))
+		if err != nil {
+			return "", err
+		}
+
+		if sess.current != w {
+			sess.last = sess.current
+			sess.current = w
+		}
+	case "rename-window":
+		_, w, _, err := s.resolve(a.get('t'))
+		if err != nil {
+			return "", err
+		}
+
+		if len(a.pos) != 1 {
+			return "", fmt.Errorf("command rename-window: too few arguments")
+		}
+
+		w.Name = a.pos[0]
+		w.Options["automatic-rename"] = "off"
+	case "rename-session":
+		sess, err := s.findSession(a.get('t'))
+		if err != nil {
+			return "", err
+		}
+
+		if len(a.pos) != 1 {
+			return "", fmt.Errorf("command rename-session: too few arguments")
+		}
+
+		if other, err := s.findSession("=" + a.pos[0]); err == nil && other != sess {
+			return "", fmt.Errorf("duplicate session: %s", a.pos[0])
+		}
+
+		sess.Name = a.pos[0]
+	case "select-layout":
+		_, w, _, err := s.resolve(a.get('t'))
+		if err != nil {
+			return "", err
+		}
+
+		if len(a.pos) > 0 {
+			w.Layouts = append(w.Layouts, a.pos[0])
+
+			// Named layouts (tiled, even-horizontal, ...) are only
+			// recorded
+			if _, err := layout.Parse(a.pos[0]); err == nil {
+				return "", w.applyLayout(a.pos[0])
+			}
+		}
+	case "send-keys":
+		_, _, p, err := s.resolve(a.get('t'))
+		if err != nil {
+			return "", err
+		}
+
+		if a.has('X') {
+			if slices.Contains(a.pos, "cancel") {
+				p.Mode = ""
+			}
+
+			return "", nil
+		}
+
+		p.Keys = append(p.Keys, a.pos...)
+	case "show-options":
+		return s.cmdShowOptions(a)
+	case "set-option":
+		return "", s.cmdSetOption(a)
+	case "show-environment":
+		return s.cmdShowEnvironment(a)
+	case "set-environment":
+		return "", s.cmdSetEnvironment(a)
+	case "move-window":
+		return "", s.cmdMoveWindow(a)
+	case "respawn-pane":
+		return "", s.cmdRespawnPane(a)
+	case "capture-pane":
+		return s.cmdCapturePane(a)
+	case "resize-pane":
+		_, w, _, err := s.resolve(a.get('t'))
+		if err != nil {
+			return "", err
+		}
+
+		// Only zooming is kept track of, and like tmux a window with
+		// one pane can't zoom
+		if a.has('Z') && len(w.root.panes()) > 1 {
+			w.Zoomed = !w.Zoomed
+		}
+	case "copy-mode":
+		_, _, p, err := s.resolve(a.get('t'))
+		if err != nil {
+			return "", err
+		}
+
+		p.Mode = "copy-mode"
+	case "display-message":
+		return s.cmdDisplayMessage(a)
+	case "list-panes":
+		return s.cmdListPanes(a)
+	case "list-windows":
+		return s.cmdListWindows(a)
+	case "list-sessions":
+		var lines []string
+		for _, sess := range s.sessions {
+			l := s.format(a, defaultSessionFormat, sess, sess.current, sess.current.active)
+			if !a.has('F') && sess.Attached+sess.Control > 0 {
+				l += " (attached)"
+			}
+
+			lines = append(lines, l)
+		}
+
+		return strings.Join(lines, "\n"), nil
+	case "list-clients":
+		return s.cmdListClients(a)
+	case "attach-session":
+		sess, err := s.findSession(a.get('t'))
+		if err != nil {
+			return "", err
+		}
+
+		sess.Attached++
+		s.current = sess
+	case "switch-client":
+		sess, w, p, err := s.resolve(a.get('t'))
+		if err != nil {
+			return "", err
+		}
+
+		if s.current != nil && s.current != sess && s.current.Attached > 0 {
+			s.current.Attached--
+			sess.Attached++
+		}
+
+		s.current = sess
+		sess.current = w
+		w.active = p
+	case "detach-client":
+		sess, err := s.findSession(a.get('s'))
+		if err != nil {
+			return "", err
+		}
+
+		sess.Attached = max(sess.Attached-1, 0)
+	}
+
+	// Everything else (bind-key, display-popup,
+	// refresh-client, ...) is accepted and only logged
+
+	return "", nil
+}
+
+// format expands the -F format from a (or def if there isn't one) for
+// the given objects
+func (s *Server) format(a args, def string, sess *Session, w *Window, p *Pane) string {
+	f := def
+	if a.has('F') {
+		f = a.get('F')
+	}
+
+	return expand(f, s.formatVars(sess, w, p))
+}
+
+func (s *Server) newPane(w *Window, cwd string, argv []string) *Pane {
+	s.nextPane++
+	s.nextPID++
+
+	p := &Pane{
+		ID:      s.nextPane - 1,
+		PID:     s.nextPID,
+		Cwd:     cwd,
+		Command: "bash",
+		Title:   "tmuxtest",
+		Start:   strings.Join(argv, " "),
+		Options: map[string]string{},
+		window:  w,
+	}
+
+	if len(argv) > 0 {
+		p.Command = path.Base(strings.Fields(argv[0] + " x")[0])
+	}
+
+	return p
+}
+
+func (s *Server) newWindow(sess *Session, idx int, name, cwd string, argv []string) *Window {
+	s.nextWindow++
+
+	w := &Window{
+		ID:      s.nextWindow - 1,
+		Index:   idx,
+		Options: map[string]string{},
+		session: sess,
+	}
+
+	p := s.newPane(w, cwd, argv)
+	w.root = newPaneCell(p, 0, 0, s.Width, s.Height)
+	w.active = p
+
+	// A name given up front turns automatic-rename off, same as
+	// rename-window
+	w.Name = name
+	if w.Name == "" {
+		w.Name = p.Command
+	} else {
+		w.Options["automatic-rename"] = "off"
+	}
+
+	sess.Windows = append(sess.Windows, w)
+	slices.SortFunc(sess.Windows, func(a, b *Window) int { return a.Index - b.Index })
+
+	return w
+}
+
+func (s *Server) cmdNewSession(a args) (string, error) {
+	s.nextSession++
+
+	name := a.get('s')
+	if name == "" {
+		name = strconv.Itoa(s.nextSession - 1)
+	}
+
+	if _, err := s.findSession("=" + name); err == nil {
+		return "", fmt.Errorf("duplicate session: %s", name)
+	}
+
+	sess := &Session{
+		ID:          s.nextSession - 1,
+		Name:        name,
+		Path:        "/",
+		Environment: map[string]string{},
+		Options:     map[string]string{},
+	}
+
+	if a.has('c') {
+		sess.Path = a.get('c')
+	}
+
+	if e := a.get('e'); e != "" {
+		k, v, _ := strings.Cut(e, "=")
+		sess.Environment[k] = v
+	}
+
+	width, height := s.Width, s.Height
+	defer func() { s.Width, s.Height = width, height }()
+
+	if a.has('x') {
+		s.Width, _ = strconv.Atoi(a.get('x'))
+	}
+
+	if a.has('y') {
+		s.Height, _ = strconv.Atoi(a.get('y'))
+	}
+
+	w := s.newWindow(sess, s.optionInt("base-index", nil, nil, nil), a.get('n'), sess.Path, a.pos)
+	sess.current = w
+
+	s.sessions = append(s.sessions, sess)
+
+	if !a.has('d') {
+		sess.Attached++
+		s.current = sess
+	}
+
+	if a.has('P') {
+		return s.format(a, "#{session_name}:", sess, w, w.active), nil
+	}
+
+	return "", nil
+}
+
+func (s *Server) cmdNewWindow(a args) (string, error) {
+	target := a.get('t')
+	idx := -1
+
+	// "sess:3" asks for index 3
+	if sessName, winName, ok := strings.Cut(target, ":"); ok {
+		if n, err := strconv.Atoi(winName); err == nil {
+			idx = n
+			target = sessName
+		}
+	}
+
+	sess, err := s.findSession(target)
+	if err != nil {
+		return "", err
+	}
+
+	if idx == -1 {
+		idx = s.freeIndex(sess)
+	} else if _, err := findWindow(sess, strconv.Itoa(idx)); err == nil {
+		return "", fmt.Errorf("create window failed: index %d in use", idx)
+	}
+
+	cwd := sess.Path
+	if a.has('c') {
+		cwd = a.get('c')
+	}
+
+	w := s.newWindow(sess, idx, a.get('n'), cwd, a.pos)
+
+	if !a.has('d') {
+		sess.last = sess.current
+		sess.current = w
+	}
+
+	if a.has('P') {
+		return s.format(a, "#{session_name}:#{window_index}", sess, w, w.active), nil
+	}
+
+	return "", nil
+}
+
+// freeIndex is the first window index from base-index up that sess isn't
+// using
+func (s *Server) freeIndex(sess *Session) int {
+	idx := s.optionInt("base-index", sess, nil, nil)
+
+	for {
+		if _, err := findWindow(sess, strconv.Itoa(idx)); err != nil {
+			return idx
+		}
+
+		idx++
+	}
+}
+
+// cmdMoveWindow moves the -s window to the -t index, which can be in another
+// session. A session left without windows goes away, as in tmux.
+func (s *Server) cmdMoveWindow(a args) error {
+	_, w, _, err := s.resolve(a.get('s'))
+	if err != nil {
+		return err
+	}
+
+	if a.has('r') {
+		sess, err := s.findSession(a.get('t'))
+		if err != nil {
+			return err
+		}
+
+		for i, o := range sess.Windows {
+			o.Index = s.optionInt("base-index", sess, nil, nil) + i
+		}
+
+		return nil
+	}
+
+	// "sess:3", "sess:" or "sess"
+	target := a.get('t')
+	sessName, winName, _ := strings.Cut(target, ":")
+
+	dst, err := s.findSession(sessName)
+	if err != nil {
+		return err
+	}
+
+	idx := -1
+	if winName != "" {
+		idx, err = strconv.Atoi(winName)
+		if err != nil {
+			return fmt.Errorf("can't find window: %s", winName)
+		}
+	}
+
+	if other, err := findWindow(dst, winName); winName != "" && err == nil && other != w {
+		if !a.has('k') {
+			return fmt.Errorf("index in use: %d", idx)
+		}
+
+		s.killWindow(other)
+	}
+
+	if w.session != dst {
+		s.killWindow(w)
+
+		w.session = dst
+		dst.Windows = append(dst.Windows, w)
+	}
+
+	if idx == -1 {
+		idx = s.freeIndex(dst)
+	}
+
+	w.Index = idx
+	slices.SortFunc(dst.Windows, func(a, b *Window) int { return a.Index - b.Index })
+
+	if !a.has('d') && dst.current != w {
+		dst.last = dst.current
+		dst.current = w
+	}
+
+	return nil
+}
+
+// cmdRespawnPane starts the pane over with a new command (or the default
+// shell). Fake panes never exit, so it needs -k like it would in tmux for a
+// running pane.
+func (s *Server) cmdRespawnPane(a args) error {
+	_, _, p, err := s.resolve(a.get('t'))
+	if err != nil {
+		return err
+	}
+
+	if !a.has('k') {
+		return fmt.Errorf("pane %s still active", p.Target())
+	}
+
+	cwd := p.Cwd
+	if a.has('c') {
+		cwd = a.get('c')
+	}
+
+	fresh := s.newPane(p.window, cwd, a.pos)
+
+	p.PID = fresh.PID
+	p.Cwd = fresh.Cwd
+	p.Command = fresh.Command
+	p.Start = fresh.Start
+	p.Mode = ""
+	p.Output = nil
+
+	// newPane counted a pane ID it won't use
+	s.nextPane--
+
+	return nil
+}
+
+// cmdCapturePane prints the visible part of the pane's Output, plus -S lines
+// of history above it ("-" for all of it)
+func (s *Server) cmdCapturePane(a args) (string, error) {
+	_, _, p, err := s.resolve(a.get('t'))
+	if err != nil {
+		return "", err
+	}
+
+	// Without -p the lines go in a paste buffer
+	if !a.has('p') {
+		return "", nil
+	}
+
+	n := p.cell.sy
+
+	switch start := a.get('S'); {
+	case start == "-":
+		n = len(p.Output)
+	case start != "":
+		i, err := strconv.Atoi(start)
+		if err != nil {
+			return "", fmt.Errorf("start line invalid: %s", start)
+		}
+
+		if i < 0 {
+			n -= i
+		}
+	}
+
+	return strings.Join(p.Output[len(p.Output)-min(n, len(p.Output)):], "\n"), nil
+}
+
+func (s *Server) cmdListClients(a args) (string, error) {
+	sessions := s.sessions
+
+	if a.has('t') {
+		sess, err := s.findSession(a.get('t'))
+		if err != nil {
+			return "", err
+		}
+
+		sessions = []*Session{sess}
+	}
+
+	var lines []string
+
+	n := 0
+	add := func(sess *Session, control bool) {
+		vars := s.formatVars(sess, sess.current, sess.current.active)
+
+		client := map[string]string{
+			"client_name":         fmt.Sprintf("/dev/pts/%d", 100+n),
+			"client_tty":          fmt.Sprintf("/dev/pts/%d", 100+n),
+			"client_pid":          strconv.Itoa(firstPID - 1 - n),
+			"client_session":      sess.Name,
+			"client_control_mode": boolVar(control),
+			"client_activity":     "1700000000",
+		}
+
+		if control {
+			client["client_name"] = fmt.Sprintf("client-%d", firstPID-1-n)
+			client["client_tty"] = ""
+		}
+
+		for k, v := range client {
+			if _, ok := s.Vars[k]; !ok {
+				vars[k] = v
+			}
+		}
+
+		f := defaultClientFormat
+		if a.has('F') {
+			f = a.get('F')
+		}
+
+		lines = append(lines, expand(f, vars))
+		n++
+	}
+
+	for _, sess := range sessions {
+		for range sess.Attached {
+			add(sess, false)
+		}
+
+		for range sess.Control {
+			add(sess, true)
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// splitArgs reads the split direction and size flags shared by split-window
+// and join-pane
+func splitArgs(a args, c *cell) (cellType, int) {
+	typ := cellTopBottom
+	if a.has('h') {
+		typ = cellLeftRight
+	}
+
+	size := -1
+
+	if l := a.get('l'); l != "" {
+		if pct, ok := strings.CutSuffix(l, "%"); ok {
+			n, _ := strconv.Atoi(pct)
+			size = c.size(typ) * n / 100
+		} else {
+			size, _ = strconv.Atoi(l)
+		}
+	}
+
+	return typ, size
+}
+
+func (s *Server) cmdSplitWindow(a args) (string, error) {
+	sess, w, target, err := s.resolve(a.get('t'))
+	if err != nil {
+		return "", err
+	}
+
+	cwd := target.Cwd
+	if a.has('c') {
+		cwd = a.get('c')
+	}
+
+	p := s.newPane(w, cwd, a.pos)
+
+	typ, size := splitArgs(a, target.cell)
+
+	err = w.split(target.cell, p, typ, a.has('b'), a.has('f'), size)
+	if err != nil {
+		return "", err
+	}
+
+	if !a.has('d') {
+		w.last = w.active
+		w.active = p
+	}
+
+	if a.has('P') {
+		return s.format(a, "#{session_name}:#{window_index}.#{pane_index}", sess, w, p), nil
+	}
+
+	return "", nil
+}
+
+func (s *Server) cmdJoinPane(a args) error {
+	_, _, src, err := s.resolve(a.get('s'))
+	if err != nil {
+		return err
+	}
+
+	_, w, dst, err := s.resolve(a.get('t'))
+	if err != nil {
+		return err
+	}
+
+	if src == dst {
+		return fmt.Errorf("source and target panes must be different")
+	}
+
+	typ, size := splitArgs(a, dst.cell)
+
+	if dst.cell.size(typ) < 3 {
+		return fmt.Errorf("no space for new pane")
+	}
+
+	s.detachPane(src)
+
+	src.window = w
+
+	err = w.split(dst.cell, src, typ, a.has('b'), a.has('f'), size)
+	if err != nil {
+		return err
+	}
+
+	if !a.has('d') {
+		w.last = w.active
+		w.active = src
+	}
+
+	return nil
+}
+
+func (s *Server) cmdSwapPane(a args) error {
+	_, _, dst, err := s.resolve(a.get('t'))
+	if err != nil {
+		return err
+	}
+
+	src := dst
+	if a.has('s') {
+		_, _, src, err = s.resolve(a.get('s'))
+		if err != nil {
+			return err
+		}
+	}
+
+	if src == dst {
+		return nil
+	}
+
+	sc, dc := src.cell, dst.cell
+	sw, dw := src.window, dst.window
+
+	sc.pane, dc.pane = dst, src
+	src.cell, dst.cell = dc, sc
+	src.window, dst.window = dw, sw
+
+	// Same as tmux: with -d the active pane stays in the same spot,
+	// otherwise the panes that moved become active
+	switch {
+	case a.has('d'):
+		for _, w := range []*Window{sw, dw} {
+			switch w.active {
+			case src:
+				w.active = dst
+			case dst:
+				w.active = src
+			}
+		}
+	case sw == dw:
+		sw.active = dst
+	default:
+		sw.active = dst
+		dw.active = src
+	}
+
+	return nil
+}
+
+func (s *Server) cmdKillPane(a args) error {
+	_, w, p, err := s.resolve(a.get('t'))
+	if err != nil {
+		return err
+	}
+
+	if a.has('a') {
+		for _, other := range w.root.panes() {
+			if other != p {
+				s.killPane(other)
+			}
+		}
+
+		return nil
+	}
+
+	s.killPane(p)
+
+	return nil
+}
+
+func (s *Server) cmdSelectPane(a args) error {
+	_, w, p, err := s.resolve(a.get('t'))
+	if err != nil {
+		return err
+	}
+
+	if a.has('T') {
+		p.Title = a.get('T')
+		return nil
+	}
+
+	dirs := map[byte]string{'L': "left", 'R': "right", 'U': "up", 'D': "down"}
+	for f, dir := range dirs {
+		if a.has(f) {
+			if n := neighbor(p, dir); n != nil {
+				p = n
+			}
+		}
+	}
+
+	if w.active != p {
+		w.last = w.active
+		w.active = p
+	}
+
+	return nil
+}
+
+func (s *Server) cmdDisplayMessage(a args) (string, error) {
+	sess, w, p, err := s.resolve(a.get('t'))
+	if err != nil {
+		return "", err
+	}
+
+	f := a.get('F')
+	if len(a.pos) > 0 {
+		f = a.pos[0]
+	}
+
+	out := expand(f, s.formatVars(sess, w, p))
+
+	if !a.has('p') {
+		return "", nil
+	}
+
+	return out, nil
+}
+
+func (s *Server) cmdListPanes(a args) (string, error) {
+	var lines []string
+
+	add := func(w *Window) {
+		for _, p := range w.root.panes() {
+			lines = append(lines, s.format(a, defaultPaneFormat, w.session, w, p))
+		}
+	}
+
+	switch {
+	case a.has('a'):
+		for _, sess := range s.sessions {
+			for _, w := range sess.Windows {
+				add(w)
+			}
+		}
+	case a.has('s'):
+		sess, _, _, err := s.resolve(a.get('t'))
+		if err != nil {
+			return "", err
+		}
+
+		for _, w := range sess.Windows {
+			add(w)
+		}
+	default:
+		_, w, _, err := s.resolve(a.get('t'))
+		if err != nil {
+			return "", err
+		}
+
+		add(w)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+func (s *Server) cmdListWindows(a args) (string, error) {
+	sessions := s.sessions
+
+	if !a.has('a') {
+		sess, err := s.findSession(a.get('t'))
+		if err != nil {
+			return "", err
+		}
+
+		sessions = []*Session{sess}
+	}
+
+	var lines []string
+	for _, sess := range sessions {
+		for _, w := range sess.Windows {
+			lines = append(lines, s.format(a, defaultWindowFormat, sess, w, w.active))
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// detachPane takes p out of its window without killing it. The window goes
+// away if p was its last pane.
+func (s *Server) detachPane(p *Pane) {
+	w := p.window
+
+	if !w.remove(p.cell) {
+		s.killWindow(w)
+		return
+	}
+
+	if w.last == p {
+		w.last = nil
+	}
+
+	if w.active == p {
+		w.active = w.last
+		if w.active == nil {
+			w.active = w.root.panes()[0]
+		}
+		w.last = nil
+	}
+}
+
+func (s *Server) killPane(p *Pane) {
+	s.detachPane(p)
+	p.cell = nil
+}
+
+func (s *Server) killWindow(w *Window) {
+	sess := w.session
+
+	sess.Windows = slices.DeleteFunc(sess.Windows, func(o *Window) bool { return o == w })
+
+	if len(sess.Windows) == 0 {
+		s.killSession(sess)
+		return
+	}
+
+	if sess.last == w {
+		sess.last = nil
+	}
+
+	if sess.current == w {
+		sess.current = sess.last
+		if sess.current == nil {
+			sess.current = sess.Windows[0]
+		}
+		sess.last = nil
+	}
+}
+
+func (s *Server) killSession(sess *Session) {
+	s.sessions = slices.DeleteFunc(s.sessions, func(o *Session) bool { return o == sess })
+
+	if s.current == sess {
+		s.current = nil
+	}
+}
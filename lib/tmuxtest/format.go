@@ -0,0 +1,123 @@
+package tmuxtest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// formatVars returns the format variables for p and everything it belongs
+// to. Any of the three may be nil.
+func (s *Server) formatVars(sess *Session, w *Window, p *Pane) map[string]string {
+	vars := map[string]string{
+		"version":             s.Version,
+		"socket_path":         s.SocketPath,
+		"client_control_mode": "0",
+	}
+
+	if sess != nil {
+		vars["session_id"] = fmt.Sprintf("$%d", sess.ID)
+		vars["session_name"] = sess.Name
+		vars["session_windows"] = strconv.Itoa(len(sess.Windows))
+		vars["session_attached"] = strconv.Itoa(sess.Attached + sess.Control)
+		vars["session_path"] = sess.Path
+	}
+
+	if w != nil {
+		vars["window_id"] = fmt.Sprintf("@%d", w.ID)
+		vars["window_index"] = strconv.Itoa(w.Index)
+		vars["window_name"] = w.Name
+		vars["window_layout"] = w.layoutString()
+		vars["window_visible_layout"] = w.layoutString()
+		vars["window_active"] = boolVar(w.session != nil && w.session.current == w)
+		vars["window_width"] = strconv.Itoa(w.root.sx)
+		vars["window_height"] = strconv.Itoa(w.root.sy)
+		vars["window_panes"] = strconv.Itoa(len(w.root.panes()))
+		vars["window_zoomed_flag"] = boolVar(w.Zoomed)
+	}
+
+	if p != nil {
+		c := p.cell
+		ww, wh := w.root.sx, w.root.sy
+
+		vars["pane_id"] = fmt.Sprintf("%%%d", p.ID)
+		vars["pane_index"] = strconv.Itoa(s.index(p))
+		vars["pane_pid"] = strconv.Itoa(p.PID)
+		vars["pane_tty"] = fmt.Sprintf("/dev/pts/%d", p.ID)
+		vars["pane_width"] = strconv.Itoa(c.sx)
+		vars["pane_height"] = strconv.Itoa(c.sy)
+		vars["pane_left"] = strconv.Itoa(c.x)
+		vars["pane_top"] = strconv.Itoa(c.y)
+		vars["pane_right"] = strconv.Itoa(c.x + c.sx - 1)
+		vars["pane_bottom"] = strconv.Itoa(c.y + c.sy - 1)
+		vars["pane_at_left"] = boolVar(c.x == 0)
+		vars["pane_at_top"] = boolVar(c.y == 0)
+		vars["pane_at_right"] = boolVar(c.x+c.sx == ww)
+		vars["pane_at_bottom"] = boolVar(c.y+c.sy == wh)
+		vars["pane_active"] = boolVar(w.active == p)
+		vars["pane_current_path"] = p.Cwd
+		vars["pane_current_command"] = p.Command
+		vars["pane_title"] = p.Title
+		vars["pane_mode"] = p.Mode
+		vars["pane_in_mode"] = boolVar(p.Mode != "")
+		vars["copy_cursor_y"] = ""
+		if p.Mode == "copy-mode" {
+			vars["copy_cursor_y"] = strconv.Itoa(p.CopyCursorY)
+		}
+	}
+
+	// Options can be used in formats too, the most local one wins. None
+	// of them share a name with the variables above.
+	chain := s.optionChain(sess, w, p)
+	for i := len(chain) - 1; i >= 0; i-- {
+		for k, v := range chain[i] {
+			vars[k] = v
+		}
+	}
+
+	for k, v := range s.Vars {
+		vars[k] = v
+	}
+
+	return vars
+}
+
+func boolVar(b bool) string {
+	if b {
+		return "1"
+	}
+
+	return "0"
+}
+
+// expand replaces #{name} with its value and ## with #. Unknown variables
+// expand to nothing, like they do in tmux.
+func expand(format string, vars map[string]string) string {
+	var bld strings.Builder
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '#' || i+1 >= len(format) {
+			bld.WriteByte(format[i])
+			continue
+		}
+
+		switch format[i+1] {
+		case '#':
+			bld.WriteByte('#')
+			i++
+		case '{':
+			end := strings.IndexByte(format[i:], '}')
+			if end == -1 {
+				bld.WriteString(format[i:])
+				return bld.String()
+			}
+
+			bld.WriteString(vars[format[i+2:i+end]])
+			i += end
+		default:
+			bld.WriteByte('#')
+		}
+	}
+
+	return bld.String()
+}
@@ -0,0 +1,313 @@
+package tmuxtest
+
+import (
+	"fmt"
+
+	"github.com/distek/tmux-tools/lib/layout"
+)
+
+type cellType int
+
+const (
+	cellPane cellType = iota
+	cellLeftRight
+	cellTopBottom
+)
+
+// cell is one node of a window's layout tree, the same shape tmux uses: a
+// pane, or a container splitting its area left-right or top-bottom with a
+// one cell border between children
+type cell struct {
+	typ      cellType
+	parent   *cell
+	children []*cell
+	pane     *Pane
+
+	x, y   int
+	sx, sy int
+}
+
+func newPaneCell(p *Pane, x, y, sx, sy int) *cell {
+	c := &cell{typ: cellPane, pane: p, x: x, y: y, sx: sx, sy: sy}
+	p.cell = c
+	return c
+}
+
+// size is the cell's size along the axis a container of typ splits on
+func (c *cell) size(typ cellType) int {
+	if typ == cellLeftRight {
+		return c.sx
+	}
+
+	return c.sy
+}
+
+func (c *cell) setSize(typ cellType, n int) {
+	if typ == cellLeftRight {
+		c.sx = n
+	} else {
+		c.sy = n
+	}
+}
+
+// resize moves c to x,y and makes it sx by sy, sharing the space out between
+// children in proportion to the sizes they had before
+func (c *cell) resize(x, y, sx, sy int) {
+	c.x, c.y, c.sx, c.sy = x, y, sx, sy
+
+	if c.typ == cellPane || len(c.children) == 0 {
+		return
+	}
+
+	avail := c.size(c.typ) - (len(c.children) - 1)
+
+	total := 0
+	for _, child := range c.children {
+		total += max(child.size(c.typ), 1)
+	}
+
+	offset := 0
+	used := 0
+	for i, child := range c.children {
+		n := max(child.size(c.typ), 1) * avail / total
+		if i == len(c.children)-1 {
+			n = avail - used
+		}
+		n = max(n, 1)
+
+		if c.typ == cellLeftRight {
+			child.resize(x+offset, y, n, sy)
+		} else {
+			child.resize(x, y+offset, sx, n)
+		}
+
+		used += n
+		offset += n + 1
+	}
+}
+
+// panes returns the panes under c in layout order, which is also pane index
+// order
+func (c *cell) panes() []*Pane {
+	if c.typ == cellPane {
+		return []*Pane{c.pane}
+	}
+
+	var ret []*Pane
+	for _, child := range c.children {
+		ret = append(ret, child.panes()...)
+	}
+
+	return ret
+}
+
+func (c *cell) replace(old, new *cell) {
+	for i, child := range c.children {
+		if child == old {
+			c.children[i] = new
+			new.parent = c
+			return
+		}
+	}
+}
+
+// wrap puts c inside a new container of typ that takes its place in the tree
+func (w *Window) wrap(c *cell, typ cellType) *cell {
+	parent := c.parent
+	container := &cell{typ: typ, parent: parent, x: c.x, y: c.y, sx: c.sx, sy: c.sy}
+
+	if parent == nil {
+		w.root = container
+	} else {
+		parent.replace(c, container)
+	}
+
+	container.children = []*cell{c}
+	c.parent = container
+
+	return container
+}
+
+// split makes room for p next to target (or along the whole window with
+// full). size is the new pane's size along the split, or -1 for half.
+func (w *Window) split(target *cell, p *Pane, typ cellType, before, full bool, size int) error {
+	if full {
+		target = w.root
+	}
+
+	if target.size(typ) < 3 {
+		return fmt.Errorf("no space for new pane")
+	}
+
+	container := target.parent
+	if full || container == nil || container.typ != typ {
+		if target.typ == typ {
+			container = target
+		} else {
+			container = w.wrap(target, typ)
+		}
+	}
+
+	old := target.size(typ)
+	if size < 0 || size > old-2 {
+		size = (old - 1) / 2
+	}
+
+	newCell := newPaneCell(p, 0, 0, target.sx, target.sy)
+	newCell.parent = container
+	newCell.setSize(typ, size)
+
+	// A full size split wraps the whole window, which gives up the room
+	// the same way a pane does
+	if container != target {
+		target.setSize(typ, old-size-1)
+	}
+
+	idx := 0
+	for i, child := range container.children {
+		if child == target {
+			idx = i
+			break
+		}
+	}
+
+	switch {
+	case full && before:
+		idx = 0
+	case full:
+		idx = len(container.children)
+	case !before:
+		idx++
+	}
+
+	container.children = append(container.children[:idx], append([]*cell{newCell}, container.children[idx:]...)...)
+
+	container.resize(container.x, container.y, container.sx, container.sy)
+
+	return nil
+}
+
+// remove takes c out of the tree and gives its space to a neighbor. It
+// returns false if c was the only cell left.
+func (w *Window) remove(c *cell) bool {
+	parent := c.parent
+	if parent == nil {
+		return false
+	}
+
+	idx := 0
+	for i, child := range parent.children {
+		if child == c {
+			idx = i
+			break
+		}
+	}
+
+	parent.children = append(parent.children[:idx], parent.children[idx+1:]...)
+
+	neighbor := parent.children[max(idx-1, 0)]
+	neighbor.setSize(parent.typ, neighbor.size(parent.typ)+c.size(parent.typ)+1)
+
+	c.parent = nil
+
+	if len(parent.children) == 1 {
+		only := parent.children[0]
+		only.x, only.y, only.sx, only.sy = parent.x, parent.y, parent.sx, parent.sy
+
+		if parent.parent == nil {
+			w.root = only
+			only.parent = nil
+		} else {
+			parent.parent.replace(parent, only)
+		}
+
+		only.resize(only.x, only.y, only.sx, only.sy)
+
+		return true
+	}
+
+	parent.resize(parent.x, parent.y, parent.sx, parent.sy)
+
+	return true
+}
+
+// toLayout converts the tree under c to a layout.Cell
+func (c *cell) toLayout() *layout.Cell {
+	lc := &layout.Cell{
+		Width:  c.sx,
+		Height: c.sy,
+		X:      c.x,
+		Y:      c.y,
+		PaneID: -1,
+	}
+
+	switch c.typ {
+	case cellPane:
+		lc.Type = layout.Pane
+		lc.PaneID = c.pane.ID
+	case cellLeftRight:
+		lc.Type = layout.LeftRight
+	case cellTopBottom:
+		lc.Type = layout.TopBottom
+	}
+
+	for _, child := range c.children {
+		lc.Children = append(lc.Children, child.toLayout())
+	}
+
+	return lc
+}
+
+// fromLayout builds a tree shaped like lc, handing out panes in order
+func fromLayout(lc *layout.Cell, panes []*Pane, next *int) *cell {
+	c := &cell{x: lc.X, y: lc.Y, sx: lc.Width, sy: lc.Height}
+
+	switch lc.Type {
+	case layout.Pane:
+		c.typ = cellPane
+		c.pane = panes[*next]
+		c.pane.cell = c
+		*next++
+	case layout.LeftRight:
+		c.typ = cellLeftRight
+	case layout.TopBottom:
+		c.typ = cellTopBottom
+	}
+
+	for _, child := range lc.Children {
+		cc := fromLayout(child, panes, next)
+		cc.parent = c
+		c.children = append(c.children, cc)
+	}
+
+	return c
+}
+
+// layoutString is the window_layout format
+func (w *Window) layoutString() string {
+	return w.root.toLayout().String()
+}
+
+// applyLayout rearranges the window's panes to match a layout string, the
+// same way select-layout does for custom layouts
+func (w *Window) applyLayout(s string) error {
+	lc, err := layout.Parse(s)
+	if err != nil {
+		return fmt.Errorf("invalid layout: %s", s)
+	}
+
+	panes := w.root.panes()
+	if len(lc.Panes()) != len(panes) {
+		return fmt.Errorf("invalid layout: %s", s)
+	}
+
+	err = lc.Scale(w.root.sx, w.root.sy)
+	if err != nil {
+		return fmt.Errorf("invalid layout: %s", s)
+	}
+
+	next := 0
+	w.root = fromLayout(lc, panes, &next)
+
+	return nil
+}
@@ -0,0 +1,262 @@
+package tmuxtest
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// optionChain is where an option for p, w or sess is looked up, most local
+// first. Any of the three may be nil.
+func (s *Server) optionChain(sess *Session, w *Window, p *Pane) []map[string]string {
+	var ret []map[string]string
+
+	if p != nil {
+		ret = append(ret, p.Options)
+	}
+
+	if w != nil {
+		ret = append(ret, w.Options, s.WindowOptions)
+
+		if sess == nil {
+			sess = w.session
+		}
+	}
+
+	if sess != nil {
+		ret = append(ret, sess.Options)
+	}
+
+	return append(ret, s.Options)
+}
+
+// option looks name up the way tmux does, from the pane out to the global
+// options
+func (s *Server) option(name string, sess *Session, w *Window, p *Pane) (string, bool) {
+	for _, m := range s.optionChain(sess, w, p) {
+		if v, ok := m[name]; ok {
+			return v, true
+		}
+	}
+
+	return "", false
+}
+
+func (s *Server) optionInt(name string, sess *Session, w *Window, p *Pane) int {
+	v, _ := s.option(name, sess, w, p)
+	n, _ := strconv.Atoi(v)
+
+	return n
+}
+
+// optionMap is the options show-options and set-option work on for the
+// scope and target flags in a
+func (s *Server) optionMap(a args) (map[string]string, error) {
+	switch {
+	case a.has('g') && (a.has('w') || a.has('p')):
+		return s.WindowOptions, nil
+	case a.has('g'), a.has('s'):
+		return s.Options, nil
+	}
+
+	sess, w, p, err := s.resolve(a.get('t'))
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case a.has('p'):
+		return p.Options, nil
+	case a.has('w'):
+		return w.Options, nil
+	}
+
+	return sess.Options, nil
+}
+
+// arrayItem splits "name[3]" into name and 3, or returns -1 for a plain name
+func arrayItem(name string) (string, int) {
+	base, rest, ok := strings.Cut(name, "[")
+	if !ok {
+		return name, -1
+	}
+
+	n, err := strconv.Atoi(strings.TrimSuffix(rest, "]"))
+	if err != nil {
+		return name, -1
+	}
+
+	return base, n
+}
+
+func (s *Server) cmdShowOptions(a args) (string, error) {
+	m, err := s.optionMap(a)
+	if err != nil {
+		return "", err
+	}
+
+	names := slices.Sorted(maps.Keys(m))
+	if len(a.pos) > 0 {
+		names = []string{a.pos[0]}
+	}
+
+	var lines []string
+
+	for _, name := range names {
+		base, idx := arrayItem(name)
+
+		v, ok := m[base]
+		if !ok {
+			continue
+		}
+
+		items := strings.Split(v, "\n")
+		if idx >= 0 {
+			if idx >= len(items) {
+				continue
+			}
+
+			items = items[idx : idx+1]
+		}
+
+		for i, item := range items {
+			switch {
+			case a.has('v'):
+				lines = append(lines, item)
+			case len(items) > 1:
+				lines = append(lines, fmt.Sprintf("%s[%d] %s", base, i, item))
+			default:
+				lines = append(lines, name+" "+item)
+			}
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+func (s *Server) cmdSetOption(a args) error {
+	m, err := s.optionMap(a)
+	if err != nil {
+		return err
+	}
+
+	if len(a.pos) == 0 {
+		return fmt.Errorf("command set-option: too few arguments")
+	}
+
+	base, idx := arrayItem(a.pos[0])
+
+	if a.has('u') || a.has('U') {
+		if idx == -1 {
+			delete(m, base)
+			return nil
+		}
+
+		items := strings.Split(m[base], "\n")
+		if idx < len(items) {
+			m[base] = strings.Join(slices.Delete(items, idx, idx+1), "\n")
+		}
+
+		return nil
+	}
+
+	if len(a.pos) < 2 {
+		return fmt.Errorf("command set-option: too few arguments")
+	}
+
+	value := a.pos[1]
+
+	old, ok := m[base]
+	if a.has('o') && ok {
+		return fmt.Errorf("already set: %s", base)
+	}
+
+	if a.has('a') {
+		value = old + value
+	}
+
+	if idx == -1 {
+		m[base] = value
+		return nil
+	}
+
+	var items []string
+	if ok {
+		items = strings.Split(old, "\n")
+	}
+
+	for len(items) <= idx {
+		items = append(items, "")
+	}
+
+	items[idx] = value
+	m[base] = strings.Join(items, "\n")
+
+	return nil
+}
+
+// environment is the environment set-environment and show-environment work
+// on for a
+func (s *Server) environment(a args) (map[string]string, error) {
+	if a.has('g') {
+		return s.Environment, nil
+	}
+
+	sess, err := s.findSession(a.get('t'))
+	if err != nil {
+		return nil, err
+	}
+
+	return sess.Environment, nil
+}
+
+func (s *Server) cmdShowEnvironment(a args) (string, error) {
+	env, err := s.environment(a)
+	if err != nil {
+		return "", err
+	}
+
+	if len(a.pos) > 0 {
+		v, ok := env[a.pos[0]]
+		if !ok {
+			return "", fmt.Errorf("unknown variable: %s", a.pos[0])
+		}
+
+		return a.pos[0] + "=" + v, nil
+	}
+
+	var lines []string
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		lines = append(lines, name+"="+env[name])
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// cmdSetEnvironment sets or unsets a variable. -r (which marks it removed in
+// tmux) unsets it too.
+func (s *Server) cmdSetEnvironment(a args) error {
+	env, err := s.environment(a)
+	if err != nil {
+		return err
+	}
+
+	if len(a.pos) == 0 {
+		return fmt.Errorf("command set-environment: too few arguments")
+	}
+
+	if a.has('u') || a.has('r') {
+		delete(env, a.pos[0])
+		return nil
+	}
+
+	if len(a.pos) < 2 {
+		return fmt.Errorf("command set-environment: no value specified")
+	}
+
+	env[a.pos[0]] = a.pos[1]
+
+	return nil
+}
@@ -0,0 +1,383 @@
+// Package tmuxtest is a fake tmux server for testing lib and cmd without a
+// tmux binary or a terminal.
+//
+// A Server keeps sessions, windows and panes (with real pane geometry) in
+// memory and answers the commands lib sends it. Install it with lib.SetRunner
+// (or Server.Install) and everything that would have run tmux runs against
+// the fake instead. Every command is logged so tests can check what was sent.
+package tmuxtest
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/distek/tmux-tools/lib"
+)
+
+// Session is a fake tmux session
+type Session struct {
+	ID       int
+	Name     string
+	Path     string
+	Attached int
+	Windows  []*Window
+
+	// Control mode clients attached to the session. tmux counts them in
+	// session_attached too, but list-clients tells them apart.
+	Control int
+
+	// Set with set-environment and new-session -e
+	Environment map[string]string
+
+	// Session options set on the session itself
+	Options map[string]string
+
+	current *Window
+	last    *Window
+}
+
+// Window is a fake tmux window. Its panes are laid out the way tmux does it,
+// in a tree of left-right and top-bottom splits.
+type Window struct {
+	ID     int
+	Index  int
+	Name   string
+	Zoomed bool
+
+	// Layouts passed to select-layout, most recent last
+	Layouts []string
+
+	// Window options set on the window itself
+	Options map[string]string
+
+	session *Session
+	root    *cell
+	active  *Pane
+	last    *Pane
+}
+
+// Pane is a fake tmux pane
+type Pane struct {
+	ID      int
+	PID     int
+	Cwd     string
+	Command string
+	Title   string
+	Mode    string
+
+	// Row of the copy mode cursor, see copy_cursor_y
+	CopyCursorY int
+
+	// Every key sent with send-keys, one entry per argument
+	Keys []string
+
+	// The shell command the pane was started (or respawned) with, empty
+	// for the default shell
+	Start string
+
+	// What capture-pane prints: the pane's history followed by what's on
+	// screen, one line each
+	Output []string
+
+	// Pane options set on the pane itself
+	Options map[string]string
+
+	window *Window
+	cell   *cell
+}
+
+// Server is a fake tmux server. The zero value isn't usable, use NewServer.
+type Server struct {
+	// Size of windows in new sessions, 80x24 by default
+	Width, Height int
+
+	// Values for #{version} and #{socket_path}
+	Version    string
+	SocketPath string
+
+	// Extra format variables, these win over the built in ones
+	Vars map[string]string
+
+	// Global session (and server) options, global window (and pane)
+	// options and the global environment. NewServer sets the defaults the
+	// commands here care about, such as base-index. Array options hold one
+	// item per line.
+	Options       map[string]string
+	WindowOptions map[string]string
+	Environment   map[string]string
+
+	mu       sync.Mutex
+	sessions []*Session
+	current  *Session
+	log      []string
+
+	nextSession, nextWindow, nextPane, nextPID int
+}
+
+// Fake pane PIDs start above the largest pid_max Linux allows, so looking one
+// up in /proc never finds a real process
+const firstPID = 1 << 23
+
+// NewServer returns an empty server, as if tmux had just started with no
+// sessions
+func NewServer() *Server {
+	return &Server{
+		Width:      80,
+		Height:     24,
+		Version:    "3.4",
+		SocketPath: "/tmp/tmuxtest/default",
+		Vars:       map[string]string{},
+		Options: map[string]string{
+			"base-index":         "0",
+			"default-command":    "",
+			"default-shell":      "/bin/sh",
+			"update-environment": "DISPLAY\nKRB5CCNAME\nSSH_ASKPASS\nSSH_AUTH_SOCK\nSSH_AGENT_PID\nSSH_CONNECTION\nWINDOWID\nXAUTHORITY",
+		},
+		WindowOptions: map[string]string{
+			"automatic-rename": "on",
+			"pane-base-index":  "0",
+		},
+		Environment: map[string]string{},
+		nextPID:     firstPID,
+	}
+}
+
+// Install makes lib send commands to s and returns a func that puts the old
+// Runner back
+func (s *Server) Install() func() {
+	old := lib.SetRunner(s)
+
+	return func() { lib.SetRunner(old) }
+}
+
+// Log returns every command received so far, written the way tmux's command
+// parser would read them
+func (s *Server) Log() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.log)
+}
+
+// ResetLog clears the command log
+func (s *Server) ResetLog() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.log = nil
+}
+
+// Sessions returns the sessions on the server
+func (s *Server) Sessions() []*Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.sessions)
+}
+
+// Session finds a session by name
+func (s *Server) Session(name string) *Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sess := range s.sessions {
+		if sess.Name == name {
+			return sess
+		}
+	}
+
+	return nil
+}
+
+// Pane finds a pane by ID, such as "%3"
+func (s *Server) Pane(id string) *Pane {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, _ := s.paneByID(id)
+
+	return p
+}
+
+// Panes returns the panes of w in index order
+func (w *Window) Panes() []*Pane {
+	return w.root.panes()
+}
+
+// Active returns the window's active pane
+func (w *Window) Active() *Pane {
+	return w.active
+}
+
+// Geometry returns the pane's position and size in its window
+func (p *Pane) Geometry() (left, top, width, height int) {
+	return p.cell.x, p.cell.y, p.cell.sx, p.cell.sy
+}
+
+// Target returns the pane's ID in target form, e.g. "%3"
+func (p *Pane) Target() string {
+	return fmt.Sprintf("%%%d", p.ID)
+}
+
+// index is the pane's pane_index, counting from pane-base-index
+func (s *Server) index(p *Pane) int {
+	return slices.Index(p.window.root.panes(), p) + s.optionInt("pane-base-index", nil, p.window, p)
+}
+
+// Run implements lib.Runner
+func (s *Server) Run(c *lib.Cmd) (string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.log = append(s.log, c.String())
+
+	out, err := s.run(c.Name(), c.Args())
+	if err != nil {
+		return "", err.Error(), err
+	}
+
+	return out, "", nil
+}
+
+var aliases = map[string]string{
+	"a":        "attach-session",
+	"attach":   "attach-session",
+	"detach":   "detach-client",
+	"display":  "display-message",
+	"has":      "has-session",
+	"joinp":    "join-pane",
+	"killp":    "kill-pane",
+	"killw":    "kill-window",
+	"lastp":    "last-pane",
+	"ls":       "list-sessions",
+	"lsc":      "list-clients",
+	"lsp":      "list-panes",
+	"lsw":      "list-windows",
+	"new":      "new-session",
+	"neww":     "new-window",
+	"rename":   "rename-session",
+	"renamew":  "rename-window",
+	"selectl":  "select-layout",
+	"selectp":  "select-pane",
+	"selectw":  "select-window",
+	"send":     "send-keys",
+	"splitw":   "split-window",
+	"swapp":    "swap-pane",
+	"switchc":  "switch-client",
+	"refresh":  "refresh-client",
+	"copy":     "copy-mode",
+	"popup":    "display-popup",
+	"set":      "set-option",
+	"bind":     "bind-key",
+	"killsess": "kill-session",
+	"show":     "show-options",
+	"showenv":  "show-environment",
+	"setenv":   "set-environment",
+	"movew":    "move-window",
+	"respawnp": "respawn-pane",
+	"capturep": "capture-pane",
+	"resizep":  "resize-pane",
+}
+
+// getopt specs, same syntax as tmux's own: a letter followed by ':' takes a
+// value
+var specs = map[string]string{
+	"attach-session":   "dErx:c:f:t:",
+	"bind-key":         "nrN:T:",
+	"capture-pane":     "ab:CeE:JNpPqS:t:T",
+	"copy-mode":        "eHMqt:u",
+	"detach-client":    "aPs:t:",
+	"display-message":  "ac:d:F:INpt:v",
+	"display-popup":    "BCEc:d:e:h:s:S:t:T:w:x:y:",
+	"has-session":      "t:",
+	"join-pane":        "bdfhvp:l:s:t:",
+	"kill-pane":        "at:",
+	"kill-server":      "",
+	"kill-session":     "aCt:",
+	"kill-window":      "at:",
+	"last-pane":        "det:Z",
+	"list-clients":     "F:f:t:",
+	"list-panes":       "asF:f:t:",
+	"list-sessions":    "F:f:",
+	"list-windows":     "aF:f:t:",
+	"move-window":      "abdkrs:t:",
+	"new-session":      "Ac:dDe:EF:f:n:Ps:t:x:Xy:",
+	"new-window":       "abc:de:F:kn:PSt:",
+	"refresh-client":   "A:B:cC:Df:F:l:LRSt:U",
+	"rename-session":   "t:",
+	"rename-window":    "t:",
+	"resize-pane":      "DLMRTt:Ux:y:Z",
+	"respawn-pane":     "c:e:kt:",
+	"select-layout":    "Enopt:",
+	"select-pane":      "DdegLlMmP:RT:t:UZ",
+	"select-window":    "lnpTt:",
+	"send-keys":        "FHKlMN:Rt:X",
+	"set-environment":  "Fhgrt:u",
+	"set-option":       "aFgopqst:uUw",
+	"show-environment": "hgst:",
+	"show-options":     "AgHpqst:vw",
+	"split-window":     "bc:de:fF:hIl:p:Pt:vZ",
+	"swap-pane":        "dDs:t:UZ",
+	"switch-client":    "c:EFlnO:pt:rT:Z",
+}
+
+type args struct {
+	flags map[byte]string
+	pos   []string
+}
+
+func (a args) has(f byte) bool {
+	_, ok := a.flags[f]
+	return ok
+}
+
+func (a args) get(f byte) string {
+	return a.flags[f]
+}
+
+func parseArgs(name string, argv []string) (args, error) {
+	spec := specs[name]
+	ret := args{flags: map[byte]string{}}
+
+	i := 0
+	for ; i < len(argv); i++ {
+		a := argv[i]
+		if a == "--" {
+			i++
+			break
+		}
+
+		if len(a) < 2 || a[0] != '-' {
+			break
+		}
+
+		for j := 1; j < len(a); j++ {
+			at := strings.IndexByte(spec, a[j])
+			if at == -1 || a[j] == ':' {
+				return args{}, fmt.Errorf("command %s: unknown flag -%c", name, a[j])
+			}
+
+			if at+1 < len(spec) && spec[at+1] == ':' {
+				switch {
+				case j+1 < len(a):
+					ret.flags[a[j]] = a[j+1:]
+				case i+1 < len(argv):
+					i++
+					ret.flags[a[j]] = argv[i]
+				default:
+					return args{}, fmt.Errorf("command %s: -%c expects an argument", name, a[j])
+				}
+
+				break
+			}
+
+			ret.flags[a[j]] = ""
+		}
+	}
+
+	ret.pos = argv[i:]
+
+	return ret, nil
+}
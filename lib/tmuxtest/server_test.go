@@ -0,0 +1,116 @@
+package tmuxtest
+
+import (
+	"strings"
+	"testing"
+)
+
+// run sends a command line (split on spaces) to s
+func run(t *testing.T, s *Server, line string) string {
+	t.Helper()
+
+	f := strings.Fields(line)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, err := s.run(f[0], f[1:])
+	if err != nil {
+		t.Fatalf("%s: %s", line, err)
+	}
+
+	return o
+}
+
+func TestOptions(t *testing.T) {
+	s := NewServer()
+
+	run(t, s, "new-session -d -s a")
+	run(t, s, "set-option -g status-left global")
+	run(t, s, "set-option -w -t =a: monitor-activity on")
+	run(t, s, "set-option -t =a: update-environment[1] FOO")
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		// Only what's set on the session itself, not inherited
+		{"show-options -qv -t =a: status-left", ""},
+		{"show-options -gqv status-left", "global"},
+		{"show-options -w -qv -t =a: monitor-activity", "on"},
+		{"show-options -qv -t =a: update-environment", "\nFOO"},
+		{"show-options -t =a: update-environment[1]", "update-environment[1] FOO"},
+		{"show-options -gwv pane-base-index", "0"},
+		// Formats see the most local value
+		{"display-message -p -t =a: #{status-left}.#{monitor-activity}", "global.on"},
+	}
+
+	for _, tt := range tests {
+		if got := run(t, s, tt.line); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.line, got, tt.want)
+		}
+	}
+
+	run(t, s, "set-option -u -w -t =a: monitor-activity")
+
+	if got := run(t, s, "show-options -w -t =a:"); got != "" {
+		t.Errorf("unset option still there: %q", got)
+	}
+}
+
+func TestBaseIndex(t *testing.T) {
+	s := NewServer()
+
+	run(t, s, "set-option -g base-index 1")
+	run(t, s, "set-option -gw pane-base-index 1")
+	run(t, s, "new-session -d -s a")
+	run(t, s, "new-window -t =a")
+	run(t, s, "split-window -t =a:2")
+
+	if got := run(t, s, "list-panes -s -t =a -F #{window_index}.#{pane_index}"); got != "1.1\n2.1\n2.2" {
+		t.Errorf("got %q", got)
+	}
+
+	// Moving to a used index needs -k
+	if _, err := s.run("move-window", []string{"-s", "=a:2", "-t", "=a:1"}); err == nil {
+		t.Error("move-window onto a used index worked")
+	}
+
+	run(t, s, "move-window -s =a:2 -t =a:0")
+
+	if got := run(t, s, "list-windows -t =a -F #{window_index}:#{window_panes}"); got != "0:2\n1:1" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestCapturePane(t *testing.T) {
+	s := NewServer()
+	s.Height = 3
+
+	run(t, s, "new-session -d -s a")
+
+	p := s.Session("a").Windows[0].Active()
+	p.Output = []string{"1", "2", "3", "4", "5"}
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"capture-pane -p -t %0", "3\n4\n5"},
+		{"capture-pane -p -S -1 -t %0", "2\n3\n4\n5"},
+		{"capture-pane -p -S - -t %0", "1\n2\n3\n4\n5"},
+		{"capture-pane -t %0", ""},
+	}
+
+	for _, tt := range tests {
+		if got := run(t, s, tt.line); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.line, got, tt.want)
+		}
+	}
+
+	run(t, s, "respawn-pane -k -c /tmp -t %0 cat")
+
+	if p.Output != nil || p.Cwd != "/tmp" || p.Start != "cat" || p.Command != "cat" {
+		t.Errorf("respawned pane: %+v", p)
+	}
+}
@@ -0,0 +1,232 @@
+package tmuxtest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func (s *Server) paneByID(id string) (*Pane, bool) {
+	n, err := strconv.Atoi(strings.TrimPrefix(id, "%"))
+	if err != nil {
+		return nil, false
+	}
+
+	for _, sess := range s.sessions {
+		for _, w := range sess.Windows {
+			for _, p := range w.root.panes() {
+				if p.ID == n {
+					return p, true
+				}
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// currentSession is the session commands without a target act on: the one
+// last attached or switched to, else the newest
+func (s *Server) currentSession() (*Session, error) {
+	if s.current != nil {
+		return s.current, nil
+	}
+
+	if len(s.sessions) == 0 {
+		return nil, fmt.Errorf("no current session")
+	}
+
+	return s.sessions[len(s.sessions)-1], nil
+}
+
+// findSession finds the session a session target names. Like tmux, it
+// ignores a window or pane after the colon, which session names can't have.
+func (s *Server) findSession(name string) (*Session, error) {
+	name, _, _ = strings.Cut(name, ":")
+
+	if name == "" {
+		return s.currentSession()
+	}
+
+	if id, ok := strings.CutPrefix(name, "$"); ok {
+		for _, sess := range s.sessions {
+			if strconv.Itoa(sess.ID) == id {
+				return sess, nil
+			}
+		}
+	}
+
+	exact := strings.HasPrefix(name, "=")
+	name = strings.TrimPrefix(name, "=")
+
+	for _, sess := range s.sessions {
+		if sess.Name == name {
+			return sess, nil
+		}
+	}
+
+	if !exact {
+		for _, sess := range s.sessions {
+			if strings.HasPrefix(sess.Name, name) {
+				return sess, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("can't find session: %s", name)
+}
+
+func findWindow(sess *Session, name string) (*Window, error) {
+	if name == "" {
+		return sess.current, nil
+	}
+
+	if idx, err := strconv.Atoi(name); err == nil {
+		for _, w := range sess.Windows {
+			if w.Index == idx {
+				return w, nil
+			}
+		}
+
+		return nil, fmt.Errorf("can't find window: %s", name)
+	}
+
+	for _, w := range sess.Windows {
+		if w.Name == name {
+			return w, nil
+		}
+	}
+
+	return nil, fmt.Errorf("can't find window: %s", name)
+}
+
+func (s *Server) findPane(w *Window, name string) (*Pane, error) {
+	if name == "" {
+		return w.active, nil
+	}
+
+	idx, err := strconv.Atoi(name)
+	idx -= s.optionInt("pane-base-index", nil, w, nil)
+	panes := w.root.panes()
+
+	if err != nil || idx < 0 || idx >= len(panes) {
+		return nil, fmt.Errorf("can't find pane: %s", name)
+	}
+
+	return panes[idx], nil
+}
+
+// resolve finds what target points at. Session, window and pane are all
+// filled in, with the window and pane being the current ones when the
+// target only names a session or window.
+func (s *Server) resolve(target string) (*Session, *Window, *Pane, error) {
+	switch {
+	case strings.HasPrefix(target, "%"):
+		p, ok := s.paneByID(target)
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("can't find pane: %s", target)
+		}
+
+		return p.window.session, p.window, p, nil
+	case strings.HasPrefix(target, "@"):
+		for _, sess := range s.sessions {
+			for _, w := range sess.Windows {
+				if fmt.Sprintf("@%d", w.ID) == target {
+					return sess, w, w.active, nil
+				}
+			}
+		}
+
+		return nil, nil, nil, fmt.Errorf("can't find window: %s", target)
+	case strings.HasPrefix(target, "{") && strings.HasSuffix(target, "-of}"):
+		sess, w, p, err := s.resolve("")
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		n := neighbor(p, strings.TrimSuffix(strings.TrimPrefix(target, "{"), "-of}"))
+		if n == nil {
+			n = p
+		}
+
+		return sess, w, n, nil
+	}
+
+	sessName, rest, hasColon := strings.Cut(target, ":")
+	if !hasColon {
+		// No colon: "1" or "1.2" is a window in the current session,
+		// anything else is tried as a session
+		sessName, rest = "", target
+
+		if _, err := s.findSession(target); err == nil && target != "" {
+			sessName, rest = target, ""
+		}
+	}
+
+	sess, err := s.findSession(sessName)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	winName, paneName, _ := strings.Cut(rest, ".")
+
+	w, err := findWindow(sess, winName)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	p, err := s.findPane(w, paneName)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return sess, w, p, nil
+}
+
+// neighbor is the pane sharing the most border with p in dir (left, right,
+// up or down), or nil
+func neighbor(p *Pane, dir string) *Pane {
+	c := p.cell
+
+	type candidate struct {
+		pane    *Pane
+		overlap int
+	}
+
+	var found []candidate
+
+	for _, o := range p.window.root.panes() {
+		oc := o.cell
+
+		var adjacent bool
+		var overlap int
+
+		switch dir {
+		case "left":
+			adjacent = oc.x+oc.sx+1 == c.x
+			overlap = min(c.y+c.sy, oc.y+oc.sy) - max(c.y, oc.y)
+		case "right":
+			adjacent = c.x+c.sx+1 == oc.x
+			overlap = min(c.y+c.sy, oc.y+oc.sy) - max(c.y, oc.y)
+		case "up":
+			adjacent = oc.y+oc.sy+1 == c.y
+			overlap = min(c.x+c.sx, oc.x+oc.sx) - max(c.x, oc.x)
+		case "down":
+			adjacent = c.y+c.sy+1 == oc.y
+			overlap = min(c.x+c.sx, oc.x+oc.sx) - max(c.x, oc.x)
+		}
+
+		if adjacent && overlap > 0 {
+			found = append(found, candidate{o, overlap})
+		}
+	}
+
+	if len(found) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(found, func(i, j int) bool { return found[i].overlap > found[j].overlap })
+
+	return found[0].pane
+}
@@ -0,0 +1,10 @@
+package lib
+
+import "golang.org/x/sys/unix"
+
+// IsTerminal reports whether fd is a terminal
+func IsTerminal(fd uintptr) bool {
+	_, err := unix.IoctlGetTermios(int(fd), ioctlGetTermios)
+
+	return err == nil
+}
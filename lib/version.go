@@ -0,0 +1,201 @@
+package lib
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Version is a tmux version such as 3.3a
+type Version struct {
+	Major int
+	Minor int
+
+	// Suffix is the letter on a patch release, "a" for 3.3a
+	Suffix string
+
+	// Dev is set for builds from git ("master", "next-3.4"), which are
+	// assumed to have everything
+	Dev bool
+}
+
+// ParseVersion reads the version from `tmux -V` ("tmux 3.3a") or the
+// #{version} format ("3.3a", "next-3.4", "3.2-rc3", "openbsd-7.4")
+func ParseVersion(s string) (Version, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "tmux ")
+
+	if s == "master" || strings.HasPrefix(s, "next-") {
+		return Version{Dev: true}, nil
+	}
+
+	// OpenBSD base ships whatever tmux was current at the time, which is at
+	// least 3.3 for anything still supported
+	if strings.HasPrefix(s, "openbsd-") {
+		return Version{Major: 3, Minor: 3}, nil
+	}
+
+	s, _, _ = strings.Cut(s, "-")
+
+	major, rest, ok := strings.Cut(s, ".")
+	if !ok {
+		return Version{}, fmt.Errorf("lib: ParseVersion: %q: no minor version", s)
+	}
+
+	var v Version
+	var err error
+
+	v.Major, err = strconv.Atoi(major)
+	if err != nil {
+		return Version{}, fmt.Errorf("lib: ParseVersion: %q: %s", s, err)
+	}
+
+	digits := strings.TrimRightFunc(rest, func(r rune) bool { return r < '0' || r > '9' })
+	v.Suffix = rest[len(digits):]
+
+	v.Minor, err = strconv.Atoi(digits)
+	if err != nil {
+		return Version{}, fmt.Errorf("lib: ParseVersion: %q: %s", s, err)
+	}
+
+	return v, nil
+}
+
+// AtLeast reports whether v is min or newer
+func (v Version) AtLeast(min Version) bool {
+	if v.Dev {
+		return true
+	}
+
+	if v.Major != min.Major {
+		return v.Major > min.Major
+	}
+
+	if v.Minor != min.Minor {
+		return v.Minor > min.Minor
+	}
+
+	return v.Suffix >= min.Suffix
+}
+
+func (v Version) String() string {
+	if v.Dev {
+		return "master"
+	}
+
+	return fmt.Sprintf("%d.%d%s", v.Major, v.Minor, v.Suffix)
+}
+
+// Feature is something tmux-tools uses that only some tmux versions have
+type Feature struct {
+	Name string
+	Min  Version
+}
+
+var (
+	FeaturePopup         = Feature{"display-popup", Version{Major: 3, Minor: 2}}
+	FeaturePaneAt        = Feature{"pane_at_* formats", Version{Major: 2, Minor: 6}}
+	FeatureCopyCursor    = Feature{"copy_cursor_* formats", Version{Major: 3, Minor: 1}}
+	FeatureSubscriptions = Feature{"format subscriptions (refresh-client -B)", Version{Major: 3, Minor: 2}}
+	FeatureClientFlags   = Feature{"client flags (refresh-client -f)", Version{Major: 3, Minor: 2}}
+	FeaturePaneOptions   = Feature{"pane options (set-option -p)", Version{Major: 3, Minor: 0}}
+	FeatureDetachEvents  = Feature{"%client-detached notifications", Version{Major: 3, Minor: 2}}
+)
+
+var (
+	versionMu     sync.Mutex
+	clientVersion *Version
+
+	// Server versions by global args, so -L/-S pointing somewhere else
+	// gets asked again
+	serverVersions = map[string]Version{}
+)
+
+// ClientVersion is the version of the tmux binary in $PATH
+func ClientVersion() (Version, error) {
+	versionMu.Lock()
+	defer versionMu.Unlock()
+
+	if clientVersion != nil {
+		return *clientVersion, nil
+	}
+
+	o, err := exec.Command("tmux", "-V").Output()
+	if err != nil {
+		return Version{}, fmt.Errorf("lib: ClientVersion: %s", err)
+	}
+
+	v, err := ParseVersion(string(o))
+	if err != nil {
+		return Version{}, fmt.Errorf("lib: ClientVersion: %s", err)
+	}
+
+	clientVersion = &v
+
+	return v, nil
+}
+
+// ServerVersion is the version of the running server. Servers too old for
+// #{version} are assumed to match the client.
+func ServerVersion() (Version, error) {
+	key := strings.Join(globalArgv(), " ")
+
+	versionMu.Lock()
+	v, ok := serverVersions[key]
+	versionMu.Unlock()
+
+	if ok {
+		return v, nil
+	}
+
+	o, e, err := Command("display-message").Flag("-p").Arg("#{version}").Run()
+	if err != nil {
+		return Version{}, fmt.Errorf("lib: ServerVersion: %s: %s", err, e)
+	}
+
+	if o == "" {
+		v, err = ClientVersion()
+	} else {
+		v, err = ParseVersion(o)
+	}
+
+	if err != nil {
+		return Version{}, fmt.Errorf("lib: ServerVersion: %s", err)
+	}
+
+	versionMu.Lock()
+	serverVersions[key] = v
+	versionMu.Unlock()
+
+	return v, nil
+}
+
+// Supports reports whether both the server and the tmux client have f. If
+// either version can't be found out, f is assumed to be there and the
+// command gets to fail on its own.
+func Supports(f Feature) bool {
+	return Require(f) == nil
+}
+
+// Require returns an error naming the version f needs if the server or the
+// tmux client is known to be too old for it. The client isn't checked while
+// commands go over a control mode Client: nothing runs through the tmux
+// binary then, and asking it would cost the fork the Client is there to
+// save.
+func Require(f Feature) error {
+	if v, err := ServerVersion(); err == nil && !v.AtLeast(f.Min) {
+		return fmt.Errorf("%s needs tmux %s or newer, the server is %s", f.Name, f.Min, v)
+	}
+
+	if _, ok := runner.(*Client); ok {
+		return nil
+	}
+
+	if v, err := ClientVersion(); err == nil && !v.AtLeast(f.Min) {
+		return fmt.Errorf("%s needs tmux %s or newer, tmux in $PATH is %s", f.Name, f.Min, v)
+	}
+
+	return nil
+}
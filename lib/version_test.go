@@ -0,0 +1,130 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Version
+	}{
+		{"tmux 3.3a\n", Version{Major: 3, Minor: 3, Suffix: "a"}},
+		{"3.3a", Version{Major: 3, Minor: 3, Suffix: "a"}},
+		{"3.2", Version{Major: 3, Minor: 2}},
+		{"3.2-rc3", Version{Major: 3, Minor: 2}},
+		{"next-3.5", Version{Dev: true}},
+		{"master", Version{Dev: true}},
+		{"openbsd-7.4", Version{Major: 3, Minor: 3}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.in)
+		if err != nil {
+			t.Errorf("%q: %s", tt.in, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "3", "x.2", "3.x"} {
+		if v, err := ParseVersion(in); err == nil {
+			t.Errorf("%q: got %+v, want an error", in, v)
+		}
+	}
+}
+
+func TestAtLeast(t *testing.T) {
+	tests := []struct {
+		v, min string
+		want   bool
+	}{
+		{"3.3a", "3.3", true},
+		{"3.3", "3.3a", false},
+		{"3.3a", "3.3a", true},
+		{"3.3a", "3.4", false},
+		{"3.3a", "2.9", true},
+		{"2.9a", "3.0", false},
+		{"next-3.5", "9.9", true},
+		{"master", "9.9", true},
+		{"openbsd-7.4", "3.2", true},
+		{"openbsd-7.4", "3.4", false},
+	}
+
+	for _, tt := range tests {
+		v, _ := ParseVersion(tt.v)
+		min, _ := ParseVersion(tt.min)
+
+		if got := v.AtLeast(min); got != tt.want {
+			t.Errorf("%s at least %s: got %t, want %t", tt.v, tt.min, got, tt.want)
+		}
+	}
+}
+
+// fakeVersions makes the server report server as #{version} and the tmux
+// binary report client, without running either
+func fakeVersions(t *testing.T, server, client string) {
+	t.Helper()
+
+	reset := func() {
+		versionMu.Lock()
+		clientVersion = nil
+		serverVersions = map[string]Version{}
+		versionMu.Unlock()
+	}
+
+	reset()
+	t.Cleanup(reset)
+
+	v, err := ParseVersion(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientVersion = &v
+
+	old := SetRunner(runnerFunc(func(c *Cmd) (string, string, error) {
+		return server + "\n", "", nil
+	}))
+	t.Cleanup(func() { SetRunner(old) })
+}
+
+func TestRequire(t *testing.T) {
+	f := Feature{"thing", Version{Major: 3, Minor: 3, Suffix: "a"}}
+
+	tests := []struct {
+		server, client string
+		want           string
+	}{
+		{"3.3a", "3.3a", ""},
+		{"next-3.5", "master", ""},
+		{"master", "3.4", ""},
+		{"openbsd-7.4", "openbsd-7.4", "needs tmux 3.3a or newer, the server is 3.3"},
+		{"3.3", "3.4", "needs tmux 3.3a or newer, the server is 3.3"},
+		{"3.4", "3.2", "needs tmux 3.3a or newer, tmux in $PATH is 3.2"},
+		{"next-3.5", "3.3", "tmux in $PATH is 3.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.server+"/"+tt.client, func(t *testing.T) {
+			fakeVersions(t, tt.server, tt.client)
+
+			err := Require(f)
+
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("got %s", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("got error %v, want one with %q", err, tt.want)
+			}
+
+			if got := Supports(f); got != (tt.want == "") {
+				t.Errorf("Supports: got %t", got)
+			}
+		})
+	}
+}
@@ -1 +1,51 @@
 package lib
+
+import "fmt"
+
+// Window is a tmux window
+type Window struct {
+	ID            string `json:"id" tmux:"window_id"`
+	Index         int    `json:"index" tmux:"window_index"`
+	Name          string `json:"name" tmux:"window_name"`
+	Layout        string `json:"layout" tmux:"window_layout"`
+	VisibleLayout string `json:"visibleLayout" tmux:"window_visible_layout"`
+	Active        bool   `json:"active" tmux:"window_active"`
+	Zoomed        bool   `json:"zoomed" tmux:"window_zoomed_flag"`
+	Width         int    `json:"width" tmux:"window_width"`
+	Height        int    `json:"height" tmux:"window_height"`
+	Panes         int    `json:"panes" tmux:"window_panes"`
+	SessionID     string `json:"sessionId" tmux:"session_id"`
+	SessionName   string `json:"sessionName" tmux:"session_name"`
+}
+
+// ListWindows returns the windows in session, a target such as
+// SessionTarget(name) or "$1". An empty session means the current one.
+func ListWindows(session string) ([]Window, error) {
+	c := Command("list-windows")
+	if session != "" {
+		c.Target(session)
+	}
+
+	ret, err := Query[Window](c)
+	if err != nil {
+		return nil, fmt.Errorf("lib: ListWindows: %s", err)
+	}
+
+	return ret, nil
+}
+
+// GetWindow returns the window at target, or the current window if target
+// is empty
+func GetWindow(target string) (Window, error) {
+	ret, err := QueryOne[Window](target)
+	if err != nil {
+		return Window{}, fmt.Errorf("lib: GetWindow: %s", err)
+	}
+
+	return ret, nil
+}
+
+// Target returns a target for the window
+func (w Window) Target() string {
+	return w.ID
+}